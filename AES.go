@@ -24,13 +24,14 @@ func AESEncrypt(data []byte, key []byte) ([]byte, error) {
 		return []byte{}, errors.Wrap(err, "wiz.AESEncrypt: Failed to create gcm")
 	}
 
-	nonce := make([]byte, 32)
+	nonce := make([]byte, gcm.NonceSize())
 	_, err = rand.Read(nonce)
 	if err != nil {
 		return []byte{}, errors.Wrap(err, "wiz.AESEncrypt: Failed to create nonce")
 	}
 
-	encrypted := gcm.Seal(nil, nonce, data, nil)
+	//Nonce is prepended to the output, which is where AESDecrypt expects it
+	encrypted := gcm.Seal(nonce, nonce, data, nil)
 
 	return encrypted, nil
 }
@@ -53,7 +54,7 @@ func AESDecrypt(stream []byte, key []byte) ([]byte, error) {
 	}
 
 	if len(stream) < gcm.NonceSize() {
-		return []byte{}, errors.Wrap(err, "wiz.AESDecrypt: stream is shorter than gcm.NonceSize()")
+		return []byte{}, errors.New("wiz.AESDecrypt: stream is shorter than gcm.NonceSize()")
 	}
 
 	nonce := stream[:gcm.NonceSize()]
@@ -1,7 +1,9 @@
 package wiz
 
 import (
+	"golang.org/x/text/unicode/norm"
 	"regexp"
+	"strings"
 	"unicode"
 )
 
@@ -18,7 +20,7 @@ func ASCII(b []byte) (string, bool) {
 // Converts binary to printable string - returns false if non-printable characters found
 func Printable(b []byte) (string, bool) {
 	for _, c := range b {
-		if c > unicode.MaxASCII || !unicode.IsGraphic(rune(c)) {
+		if !printableByte(c) {
 			return "", false
 		}
 	}
@@ -26,19 +28,77 @@ func Printable(b []byte) (string, bool) {
 }
 
 // Strips non-ascii characters from a string
-func StipNonASCII(in string) string {
+func StripNonASCII(in string) string {
 	re := regexp.MustCompile("[[:^ascii:]]")
 	return re.ReplaceAllLiteralString(in, "")
 }
 
+// Misspelled StripNonASCII, kept so existing code still builds
+func StipNonASCII(in string) string {
+	return StripNonASCII(in)
+}
+
+// Converts Latin letters with diacritics to plain ASCII ("Crème brûlée" to "Creme brulee", "Việt" to "Viet", "Straße" to "Strasse"), then strips anything else that isn't ASCII
+func ToASCII(in string) string {
+	b := strings.Builder{}
+	//NFD splits letters from their accents ("ệ" is "e" and two combining marks), so the marks can be dropped
+	for _, r := range norm.NFD.String(in) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if t, ok := latinTransliterations[r]; ok {
+			b.WriteString(t)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return StripNonASCII(b.String())
+}
+
 // Strips non-printable and non-ascii characters from a string
 func StripNonPrintableASCII(in string) string {
 	b := []byte(in)
 	out := []byte{}
 	for _, c := range b {
-		if c <= unicode.MaxASCII && unicode.IsGraphic(rune(c)) {
+		if printableByte(c) {
 			out = append(out, c)
 		}
 	}
 	return string(out)
 }
+
+// True for printable ASCII characters (including space)
+func printableByte(c byte) bool {
+	return c <= unicode.MaxASCII && unicode.IsGraphic(rune(c))
+}
+
+// Latin letters that have no decomposition to an ASCII letter and marks, by their ASCII replacement
+var latinLetters = map[string]string{
+	"AE": "Æ", "ae": "æ",
+	"D": "ĐÐ", "d": "đð",
+	"f": "ƒ",
+	"H": "Ħ", "h": "ħ",
+	"i":  "ı",
+	"IJ": "Ĳ", "ij": "ĳ",
+	"k": "ĸ",
+	"L": "ĿŁ", "l": "ŀł",
+	"n":  "ŉ",
+	"NG": "Ŋ", "ng": "ŋ",
+	"O": "Ø", "o": "ø",
+	"OE": "Œ", "oe": "œ",
+	"s":  "ſ",
+	"SS": "ẞ", "ss": "ß",
+	"T": "Ŧ", "t": "ŧ",
+	"TH": "Þ", "th": "þ",
+}
+
+// Each letter in latinLetters, mapped to its replacement
+var latinTransliterations = func() map[rune]string {
+	m := map[rune]string{}
+	for ascii, letters := range latinLetters {
+		for _, r := range letters {
+			m[r] = ascii
+		}
+	}
+	return m
+}()
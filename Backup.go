@@ -0,0 +1,424 @@
+package wiz
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//		Deduplicated, encrypted backups.
+
+//		Files are split into chunks with a Chunker (FastCDC). Each chunk is
+//			stored once, named after the Hash of its plaintext and encrypted with
+//			AESEncrypt. A snapshot is a manifest listing every file and the chunks
+//			that make it up, also encrypted. Backing up a mostly-unchanged tree
+//			only stores the chunks that changed, plus a new manifest.
+
+//		Layout of a backup store directory:
+//			<dir>/chunks/AB/CD/ABCD...	(encrypted chunks, sharded like BlobStore)
+//			<dir>/snapshots/<id>		(encrypted manifests)
+
+//		Snapshot IDs are the unix time of the snapshot followed by a short digest,
+//			so sorting IDs sorts snapshots by age.
+
+//		Only regular files and directories are backed up. Symlinks and other
+//			special files are skipped. When the store lives inside the tree being
+//			backed up (e.g. both under Dir()), the store itself is skipped.
+
+//		Restore refuses any manifest path that would land outside the target
+//			directory (absolute paths, "..", or symlinks leading elsewhere).
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+//		Example (nightly backup of everything next to the executable):
+//		b, err := OpenBackupStore("backups", key) //key is 32 bytes
+//		s, err := b.Snapshot("")
+//		...
+//		err = b.Restore(s.ID, "restored")
+//		err = b.Verify()
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+// Chunk sizes used for backups
+const (
+	backupMinChunk = 2 * 1024
+	backupAvgChunk = 8 * 1024
+	backupMaxChunk = 64 * 1024
+)
+
+// Encrypted, deduplicated store of snapshots
+type BackupStore struct {
+	root string
+	key  []byte
+}
+
+// Manifest of one backup run
+type Snapshot struct {
+	ID     string
+	Time   uint64
+	Source string
+	Files  []SnapshotFile
+}
+
+// One file or directory in a Snapshot. Path is relative to the snapshot source, with '/' separators. Chunks are digests, in order.
+type SnapshotFile struct {
+	Path   string
+	Dir    bool
+	Mode   uint32
+	Size   uint64
+	Chunks []string
+}
+
+// Opens (or creates) a backup store at a given relative path (relative to Dir()), using a 32 byte AES key
+func OpenBackupStore(dir string, key []byte) (BackupStore, error) {
+	if len(key) != 32 {
+		return BackupStore{}, errors.New("wiz.OpenBackupStore: Key should be 32 bytes long")
+	}
+	root := filepath.Clean(filepath.FromSlash(Dir() + dir))
+	for _, sub := range []string{"chunks", "snapshots"} {
+		err := os.MkdirAll(filepath.Join(root, sub), 0755)
+		if err != nil {
+			return BackupStore{}, errors.Wrap(err, "wiz.OpenBackupStore")
+		}
+	}
+	k := make([]byte, 32)
+	copy(k, key)
+	return BackupStore{root: root, key: k}, nil
+}
+
+// Backs up a directory at a given relative path (relative to Dir(), "" for Dir() itself) and returns the new snapshot
+func (b *BackupStore) Snapshot(source string) (Snapshot, error) {
+	src := filepath.Clean(filepath.FromSlash(Dir() + source))
+	snap := Snapshot{Time: Now(), Source: source, Files: []SnapshotFile{}}
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == b.root {
+			return filepath.SkipDir //Don't back up the backups
+		}
+		if path == src {
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		f := SnapshotFile{Path: filepath.ToSlash(rel), Mode: uint32(info.Mode().Perm())}
+		switch {
+		case info.IsDir():
+			f.Dir = true
+		case info.Mode().IsRegular():
+			f.Size = uint64(info.Size())
+			f.Chunks, err = b.storeFile(path)
+			if err != nil {
+				return errors.Wrap(err, rel)
+			}
+		default:
+			return nil //Symlinks, devices, sockets...
+		}
+		snap.Files = append(snap.Files, f)
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, "wiz.BackupStore.Snapshot")
+	}
+	manifest, err := json.Marshal(snap)
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, "wiz.BackupStore.Snapshot")
+	}
+	snap.ID = strconv.FormatUint(snap.Time, 10) + "-" + BytesToHex(Hash(manifest))[:16]
+	err = b.writeEncrypted(filepath.Join(b.root, "snapshots", snap.ID), manifest)
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, "wiz.BackupStore.Snapshot")
+	}
+	return snap, nil
+}
+
+// Returns the IDs of all snapshots, oldest first
+func (b *BackupStore) Snapshots() ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(b.root, "snapshots"))
+	if err != nil {
+		return []string{}, errors.Wrap(err, "wiz.BackupStore.Snapshots")
+	}
+	ids := []string{}
+	for _, f := range files {
+		if !f.IsDir() && !strings.HasPrefix(f.Name(), ".") {
+			ids = append(ids, f.Name())
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Reads and decrypts a snapshot manifest by ID
+func (b *BackupStore) Load(id string) (Snapshot, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return Snapshot{}, errors.New("wiz.BackupStore.Load: invalid snapshot id")
+	}
+	manifest, err := b.readEncrypted(filepath.Join(b.root, "snapshots", id))
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, "wiz.BackupStore.Load")
+	}
+	snap := Snapshot{}
+	err = json.Unmarshal(manifest, &snap)
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, "wiz.BackupStore.Load")
+	}
+	snap.ID = id
+	return snap, nil
+}
+
+// Restores a snapshot into a directory at a given relative path (relative to Dir()). Existing files are overwritten. Every path is checked before anything is written.
+func (b *BackupStore) Restore(id, target string) error {
+	snap, err := b.Load(id)
+	if err != nil {
+		return errors.Wrap(err, "wiz.BackupStore.Restore")
+	}
+	dst := filepath.Clean(filepath.FromSlash(Dir() + target))
+	paths := make([]string, len(snap.Files))
+	for i, f := range snap.Files {
+		paths[i], err = restorePath(dst, f.Path)
+		if err != nil {
+			return errors.Wrap(err, "wiz.BackupStore.Restore")
+		}
+	}
+	err = os.MkdirAll(dst, 0755)
+	if err != nil {
+		return errors.Wrap(err, "wiz.BackupStore.Restore")
+	}
+	for i, f := range snap.Files {
+		if f.Dir {
+			err = restoreDir(dst, paths[i], f)
+		} else {
+			err = b.restoreFile(dst, paths[i], f)
+		}
+		if err != nil {
+			return errors.Wrap(err, "wiz.BackupStore.Restore: "+f.Path)
+		}
+	}
+	return nil
+}
+
+// Decrypts every stored chunk and checks it against its digest, and checks that every snapshot only references chunks that exist. Error is nil only if everything checks out.
+func (b *BackupStore) Verify() error {
+	problems := []string{}
+	stored := map[string]bool{}
+	chunks := filepath.Join(b.root, "chunks")
+	err := filepath.Walk(chunks, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return err
+		}
+		digest := info.Name()
+		stored[digest] = true
+		data, err := b.readEncrypted(path)
+		if err != nil {
+			problems = append(problems, "chunk "+digest+" unreadable")
+		} else if BytesToHex(Hash(data)) != digest || b.chunkPath(digest) != path {
+			problems = append(problems, "chunk "+digest+" corrupt")
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "wiz.BackupStore.Verify")
+	}
+	ids, err := b.Snapshots()
+	if err != nil {
+		return errors.Wrap(err, "wiz.BackupStore.Verify")
+	}
+	for _, id := range ids {
+		snap, err := b.Load(id)
+		if err != nil {
+			problems = append(problems, "snapshot "+id+" unreadable")
+			continue
+		}
+		for _, f := range snap.Files {
+			for _, digest := range f.Chunks {
+				if !stored[digest] {
+					problems = append(problems, "snapshot "+id+" missing chunk "+digest+" of "+f.Path)
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("wiz.BackupStore.Verify: " + strconv.Itoa(len(problems)) + " problems: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+//
+//
+//
+//
+//
+
+// Chunks a file, stores any chunks not already present, returns its digests
+func (b *BackupStore) storeFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	chunker, err := NewChunker(file, backupMinChunk, backupAvgChunk, backupMaxChunk)
+	if err != nil {
+		return nil, err
+	}
+	digests := []string{}
+	for {
+		chunk, err := chunker.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		digest := BytesToHex(Hash(chunk))
+		path := b.chunkPath(digest)
+		_, err = os.Stat(path)
+		if os.IsNotExist(err) {
+			err = os.MkdirAll(filepath.Dir(path), 0755)
+			if err == nil {
+				err = b.writeEncrypted(path, chunk)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, digest)
+	}
+	return digests, nil
+}
+
+// Creates dir and any missing parents one at a time, checking each before
+// going deeper, so an existing symlink can't lead MkdirAll outside root
+func restoreParents(root, dir string) error {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return err
+	}
+	path := root
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		if name == "." {
+			continue
+		}
+		path = filepath.Join(path, name)
+		err = os.Mkdir(path, 0755)
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+		err = insideDir(root, path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates one directory, checking its parents as restoreFile does
+func restoreDir(root, path string, f SnapshotFile) error {
+	err := restoreParents(root, filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	err = os.Mkdir(path, os.FileMode(f.Mode)|0700)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	return insideDir(root, path)
+}
+
+// Writes one file from its chunks, via a temporary file renamed into place
+func (b *BackupStore) restoreFile(root, path string, f SnapshotFile) error {
+	err := restoreParents(root, filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //No-op once renamed
+	for _, digest := range f.Chunks {
+		chunk, err := b.readEncrypted(b.chunkPath(digest))
+		if err == nil && BytesToHex(Hash(chunk)) != digest {
+			err = errors.New("chunk " + digest + " corrupt")
+		}
+		if err == nil {
+			_, err = tmp.Write(chunk)
+		}
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	err = tmp.Close()
+	if err == nil {
+		err = os.Chmod(tmp.Name(), os.FileMode(f.Mode))
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (b *BackupStore) chunkPath(digest string) string {
+	if len(digest) < 4 {
+		return filepath.Join(b.root, "chunks", digest)
+	}
+	return filepath.Join(b.root, "chunks", digest[0:2], digest[2:4], digest)
+}
+
+func (b *BackupStore) writeEncrypted(path string, data []byte) error {
+	encrypted, err := AESEncrypt(data, b.key)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, encrypted)
+}
+
+func (b *BackupStore) readEncrypted(path string) ([]byte, error) {
+	encrypted, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []byte{}, err
+	}
+	return AESDecrypt(encrypted, b.key)
+}
+
+// Joins a manifest path onto a restore directory, refusing anything that
+// would end up outside of it
+func restorePath(root, rel string) (string, error) {
+	if rel == "" || strings.Contains(rel, `\`) || strings.HasPrefix(rel, "/") || filepath.IsAbs(filepath.FromSlash(rel)) {
+		return "", errors.New("refusing path " + strconv.Quote(rel))
+	}
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	r, err := filepath.Rel(root, path)
+	if err != nil || r == "." || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", errors.New("refusing path " + strconv.Quote(rel) + " (escapes target)")
+	}
+	return path, nil
+}
+
+// Errors if dir, after resolving symlinks, is not root or inside root
+func insideDir(root, dir string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	r, err := filepath.Rel(realRoot, realDir)
+	if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return errors.New("refusing to follow symlink out of target: " + dir)
+	}
+	return nil
+}
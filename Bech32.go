@@ -0,0 +1,244 @@
+package wiz
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+//		Bech32 (BIP 173) and bech32m (BIP 350) encoding.
+
+//		A bech32 string is a human readable part (hrp), the separator '1', the
+//			data in a 32 character alphabet, and a 6 character checksum which
+//			catches any error affecting up to 4 characters. Bech32m only differs
+//			in the checksum constant; it fixes a weakness of bech32 when
+//			characters are inserted or deleted just before a final 'p'.
+
+//		Output is lowercase. Decoding accepts all-lowercase or all-uppercase,
+//			but not a mix. BIP 173 limits strings to 90 characters; that limit
+//			is not enforced here (the checksum gets weaker past it).
+
+//		Invalid characters and mixed case give a *DecodeError (through
+//			errors.Cause), saying where in the string the problem is.
+
+//		These functions encode arbitrary bytes (converted to 5 bit groups). They
+//			do not know about segwit versions or witness programs.
+
+// Encodes bytes as bech32 with a given human readable part
+func BytesToBech32(hrp string, data []byte) (string, error) {
+	s, err := bech32Encode(hrp, data, false)
+	if err != nil {
+		return "", errors.Wrap(err, "wiz.BytesToBech32")
+	}
+	return s, nil
+}
+
+// Decodes a bech32 string, returning its human readable part and data
+func Bech32ToBytes(s string) (string, []byte, error) {
+	hrp, data, err := bech32Decode(s, false)
+	if err != nil {
+		return "", []byte{}, errors.Wrap(err, "wiz.Bech32ToBytes")
+	}
+	return hrp, data, nil
+}
+
+// Encodes bytes as bech32m with a given human readable part
+func BytesToBech32m(hrp string, data []byte) (string, error) {
+	s, err := bech32Encode(hrp, data, true)
+	if err != nil {
+		return "", errors.Wrap(err, "wiz.BytesToBech32m")
+	}
+	return s, nil
+}
+
+// Decodes a bech32m string, returning its human readable part and data
+func Bech32mToBytes(s string) (string, []byte, error) {
+	hrp, data, err := bech32Decode(s, true)
+	if err != nil {
+		return "", []byte{}, errors.Wrap(err, "wiz.Bech32mToBytes")
+	}
+	return hrp, data, nil
+}
+
+//
+//
+//
+//
+//
+
+const bech32Alphabet = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// Codec for a fixed hrp, used by GetCodec("bech32:...")
+type bech32Codec struct {
+	hrp string
+	m   bool
+}
+
+func (c bech32Codec) Encode(data []byte) string {
+	s, _ := bech32Encode(c.hrp, data, c.m) //hrp was checked by GetCodec
+	return s
+}
+
+func (c bech32Codec) Decode(s string) ([]byte, error) {
+	hrp, data, err := bech32Decode(s, c.m)
+	if err != nil {
+		return []byte{}, err
+	}
+	if hrp != c.hrp {
+		return []byte{}, errors.New("wiz: bech32 human readable part is " + strconv.Quote(hrp) + ", expected " + strconv.Quote(c.hrp))
+	}
+	return data, nil
+}
+
+func bech32Const(m bool) uint32 {
+	if m {
+		return 0x2bc830a3
+	}
+	return 1
+}
+
+func bech32Name(m bool) string {
+	if m {
+		return "bech32m"
+	}
+	return "bech32"
+}
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// hrp must be 1-83 printable ASCII characters (33-126), lowercase
+func checkHRP(hrp string) error {
+	if len(hrp) < 1 || len(hrp) > 83 {
+		return errors.New("human readable part must be 1 to 83 characters")
+	}
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return errors.New("human readable part contains an invalid character")
+		}
+	}
+	if hrp != Lowercase(hrp) {
+		return errors.New("human readable part must be lowercase")
+	}
+	return nil
+}
+
+// Regroups bits, e.g. from 8 bit bytes to 5 bit groups. When padding, a partial
+// final group is padded with zeros; when not, leftover bits must be zero.
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, bool) {
+	acc, bits := uint32(0), uint(0)
+	max := uint32(1)<<to - 1
+	out := []byte{}
+	for _, v := range data {
+		acc = acc<<from | uint32(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&max))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&max))
+		}
+	} else if bits >= from || acc<<(to-bits)&max != 0 {
+		return nil, false
+	}
+	return out, true
+}
+
+func bech32Encode(hrp string, data []byte, m bool) (string, error) {
+	err := checkHRP(hrp)
+	if err != nil {
+		return "", err
+	}
+	values, _ := convertBits(data, 8, 5, true)
+	poly := bech32Polymod(append(append(bech32HRPExpand(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ bech32Const(m)
+	sb := strings.Builder{}
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range values {
+		sb.WriteByte(bech32Alphabet[v])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Alphabet[(poly>>uint(5*(5-i)))&31])
+	}
+	return sb.String(), nil
+}
+
+func bech32Decode(s string, m bool) (string, []byte, error) {
+	name := bech32Name(m)
+	//Reject mixed case, pointing at the first character whose case differs
+	lower, upper := -1, -1
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 33 || c > 126 {
+			return "", []byte{}, &DecodeError{name, i, "invalid character " + strconv.QuoteRune(rune(c))}
+		}
+		if c >= 'a' && c <= 'z' && lower < 0 {
+			lower = i
+		}
+		if c >= 'A' && c <= 'Z' && upper < 0 {
+			upper = i
+		}
+	}
+	if lower >= 0 && upper >= 0 {
+		offset := lower
+		if upper > lower {
+			offset = upper
+		}
+		return "", []byte{}, &DecodeError{name, offset, "mixed case"}
+	}
+	s = Lowercase(s)
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 {
+		return "", []byte{}, &DecodeError{name, 0, "missing human readable part or separator"}
+	}
+	if len(s)-sep-1 < 6 {
+		return "", []byte{}, &DecodeError{name, len(s), "too short for checksum"}
+	}
+	hrp := s[:sep]
+	if checkHRP(hrp) != nil {
+		return "", []byte{}, &DecodeError{name, 0, "invalid human readable part"}
+	}
+	values := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		d := strings.IndexByte(bech32Alphabet, s[i])
+		if d < 0 {
+			return "", []byte{}, &DecodeError{name, i, "invalid character " + strconv.QuoteRune(rune(s[i]))}
+		}
+		values = append(values, byte(d))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != bech32Const(m) {
+		return "", []byte{}, errors.New("wiz: " + name + " checksum mismatch")
+	}
+	data, ok := convertBits(values[:len(values)-6], 5, 8, false)
+	if !ok {
+		return "", []byte{}, &DecodeError{name, len(s) - 7, "invalid padding"}
+	}
+	return hrp, data, nil
+}
@@ -0,0 +1,587 @@
+package wiz
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+//		Compact, deterministic binary encoding. Smaller than JSON, and the same
+//			value always encodes to the same bytes, so output can be hashed with
+//			Hash and signed with EdSign.
+
+//		BinaryWriter and BinaryReader handle one value at a time:
+//			Uvarint/Varint		variable length (7 bits per byte, zigzag for signed)
+//			Uint8..Uint64		fixed width big-endian
+//			Bytes/String		uvarint length, then the bytes
+//			Bool				one byte, 0 or 1
+
+//		EncodeBinary and DecodeBinary do whole structs by reflection, field by
+//			field in declaration order, with no field names or type information
+//			in the output (so both sides must agree on the struct):
+//				ints and uints		varints, or fixed width with `bin:"fixed"`
+//				bool, string, []byte	as above
+//				float32/64			fixed width IEEE 754 bits
+//				[N]byte				the N bytes as they are
+//				arrays				each element (no length)
+//				slices				uvarint count, then each element
+//				maps				uvarint count, then key/value pairs sorted by
+//									encoded key, so output doesn't depend on map order
+//				pointers			byte 0 for nil, else 1 then the value
+//				structs				each exported field; `bin:"-"` skips one
+//			int and uint use 64 bits. Other types are an error.
+
+//		Decoding is strict, so that any bytes that decode have exactly one
+//			encoding: over-long varints, bools other than 0 or 1, and bytes left
+//			over at the end are all errors. errors.Cause gives a *DecodeError,
+//			with the offset.
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+//		Example:
+//		type Record struct {
+//			Number    uint64
+//			Data      []byte
+//			Signature []byte
+//			Cache     string `bin:"-"`
+//		}
+//		b, err := EncodeBinary(record)
+//		sig, err := EdSign(b, pub, pri)
+//		r := Record{}
+//		err = DecodeBinary(b, &r)
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+// Builds binary encoded data. The zero value is ready to use.
+type BinaryWriter struct {
+	buf []byte
+}
+
+// Reads binary encoded data
+type BinaryReader struct {
+	data []byte
+	pos  int
+}
+
+// Encodes a value (see top of Binary.go)
+func EncodeBinary(v interface{}) ([]byte, error) {
+	if v == nil {
+		return []byte{}, errors.New("wiz.EncodeBinary: cannot encode nil")
+	}
+	w := &BinaryWriter{}
+	if err := w.encode(reflect.ValueOf(v), false); err != nil {
+		return []byte{}, errors.Wrap(err, "wiz.EncodeBinary")
+	}
+	return w.Result(), nil
+}
+
+// Decodes data made by EncodeBinary into a pointer to a value of the same type
+func DecodeBinary(data []byte, v interface{}) error {
+	p := reflect.ValueOf(v)
+	if p.Kind() != reflect.Ptr || p.IsNil() {
+		return errors.New("wiz.DecodeBinary: need a non-nil pointer")
+	}
+	r := NewBinaryReader(data)
+	if err := r.decode(p.Elem(), false); err != nil {
+		return errors.Wrap(err, "wiz.DecodeBinary")
+	}
+	if r.Remaining() != 0 {
+		return errors.Wrap(&DecodeError{"binary", r.pos, strconv.Itoa(r.Remaining()) + " bytes left over"}, "wiz.DecodeBinary")
+	}
+	return nil
+}
+
+// Returns the bytes written so far
+func (w *BinaryWriter) Result() []byte {
+	out := make([]byte, len(w.buf))
+	copy(out, w.buf)
+	return out
+}
+
+// Writes an unsigned varint
+func (w *BinaryWriter) Uvarint(n uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf = append(w.buf, b[:binary.PutUvarint(b[:], n)]...)
+}
+
+// Writes a signed (zigzag) varint
+func (w *BinaryWriter) Varint(n int64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf = append(w.buf, b[:binary.PutVarint(b[:], n)]...)
+}
+
+// Writes one byte
+func (w *BinaryWriter) Uint8(n uint8) {
+	w.buf = append(w.buf, n)
+}
+
+// Writes 2 bytes, big-endian
+func (w *BinaryWriter) Uint16(n uint16) {
+	w.buf = append(w.buf, byte(n>>8), byte(n))
+}
+
+// Writes 4 bytes, big-endian
+func (w *BinaryWriter) Uint32(n uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], n)
+	w.buf = append(w.buf, b[:]...)
+}
+
+// Writes 8 bytes, big-endian
+func (w *BinaryWriter) Uint64(n uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	w.buf = append(w.buf, b[:]...)
+}
+
+// Writes a length-prefixed byte slice
+func (w *BinaryWriter) Bytes(b []byte) {
+	w.Uvarint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+// Writes a length-prefixed string
+func (w *BinaryWriter) String(s string) {
+	w.Uvarint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// Writes a bool as one byte
+func (w *BinaryWriter) Bool(b bool) {
+	if b {
+		w.Uint8(1)
+	} else {
+		w.Uint8(0)
+	}
+}
+
+// Creates a reader over data (which is not copied)
+func NewBinaryReader(data []byte) *BinaryReader {
+	return &BinaryReader{data: data}
+}
+
+// Returns the number of bytes not yet read
+func (r *BinaryReader) Remaining() int {
+	return len(r.data) - r.pos
+}
+
+// Reads an unsigned varint
+func (r *BinaryReader) Uvarint() (uint64, error) {
+	n, size := binary.Uvarint(r.data[r.pos:])
+	if size <= 0 {
+		return 0, r.fail("invalid varint")
+	}
+	if size != uvarintSize(n) {
+		return 0, r.fail("over-long varint")
+	}
+	r.pos += size
+	return n, nil
+}
+
+// Reads a signed (zigzag) varint
+func (r *BinaryReader) Varint() (int64, error) {
+	u, err := r.Uvarint()
+	if err != nil {
+		return 0, err
+	}
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+// Reads one byte
+func (r *BinaryReader) Uint8() (uint8, error) {
+	b, err := r.take(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// Reads 2 bytes, big-endian
+func (r *BinaryReader) Uint16() (uint16, error) {
+	b, err := r.take(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+// Reads 4 bytes, big-endian
+func (r *BinaryReader) Uint32() (uint32, error) {
+	b, err := r.take(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+// Reads 8 bytes, big-endian
+func (r *BinaryReader) Uint64() (uint64, error) {
+	b, err := r.take(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// Reads a length-prefixed byte slice (a copy)
+func (r *BinaryReader) Bytes() ([]byte, error) {
+	n, err := r.length()
+	if err != nil {
+		return []byte{}, err
+	}
+	b, err := r.take(n)
+	if err != nil {
+		return []byte{}, err
+	}
+	out := make([]byte, n)
+	copy(out, b)
+	return out, nil
+}
+
+// Reads a length-prefixed string
+func (r *BinaryReader) String() (string, error) {
+	n, err := r.length()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.take(n)
+	return string(b), err
+}
+
+// Reads a bool, which must be 0 or 1
+func (r *BinaryReader) Bool() (bool, error) {
+	b, err := r.Uint8()
+	if err != nil {
+		return false, err
+	}
+	if b > 1 {
+		r.pos--
+		return false, r.fail("invalid bool")
+	}
+	return b == 1, nil
+}
+
+//
+//
+//
+//
+//
+
+func uvarintSize(n uint64) int {
+	size := 1
+	for n >= 0x80 {
+		n >>= 7
+		size++
+	}
+	return size
+}
+
+func (r *BinaryReader) fail(reason string) error {
+	return &DecodeError{"binary", r.pos, reason}
+}
+
+func (r *BinaryReader) take(n int) ([]byte, error) {
+	if n > r.Remaining() {
+		return nil, r.fail("unexpected end of data")
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// Reads a length or count, which can't be more than the bytes left
+func (r *BinaryReader) length() (int, error) {
+	start := r.pos
+	n, err := r.Uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(r.Remaining()) {
+		r.pos = start
+		return 0, r.fail("length longer than data")
+	}
+	return int(n), nil
+}
+
+func binaryFixed(field reflect.StructField) bool {
+	return field.Tag.Get("bin") == "fixed"
+}
+
+func (w *BinaryWriter) encode(v reflect.Value, fixed bool) error {
+	if !v.IsValid() {
+		return errors.New("cannot encode nil")
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		w.Bool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !fixed {
+			w.Varint(v.Int())
+			return nil
+		}
+		w.fixedUint(uint64(v.Int()), v.Type().Size())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !fixed {
+			w.Uvarint(v.Uint())
+			return nil
+		}
+		w.fixedUint(v.Uint(), v.Type().Size())
+	case reflect.Float32:
+		w.Uint32(math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		w.Uint64(math.Float64bits(v.Float()))
+	case reflect.String:
+		w.String(v.String())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			w.Bytes(v.Bytes())
+			return nil
+		}
+		w.Uvarint(uint64(v.Len()))
+		fallthrough
+	case reflect.Array:
+		if v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 {
+			for i := 0; i < v.Len(); i++ {
+				w.buf = append(w.buf, byte(v.Index(i).Uint()))
+			}
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := w.encode(v.Index(i), fixed); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		type pair struct{ key, value []byte }
+		pairs := []pair{}
+		for _, k := range v.MapKeys() {
+			kw, vw := &BinaryWriter{}, &BinaryWriter{}
+			if err := kw.encode(k, fixed); err != nil {
+				return err
+			}
+			if err := vw.encode(v.MapIndex(k), fixed); err != nil {
+				return err
+			}
+			pairs = append(pairs, pair{kw.buf, vw.buf})
+		}
+		sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].key, pairs[j].key) < 0 })
+		w.Uvarint(uint64(len(pairs)))
+		for _, p := range pairs {
+			w.buf = append(append(w.buf, p.key...), p.value...)
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			w.Uint8(0)
+			return nil
+		}
+		w.Uint8(1)
+		return w.encode(v.Elem(), fixed)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" || field.Tag.Get("bin") == "-" {
+				continue
+			}
+			if err := w.encode(v.Field(i), binaryFixed(field)); err != nil {
+				return errors.Wrap(err, field.Name)
+			}
+		}
+	default:
+		return errors.New("cannot encode type " + v.Type().String())
+	}
+	return nil
+}
+
+// Writes int and uint as 8 bytes, other integers at their own size
+func (w *BinaryWriter) fixedUint(n uint64, size uintptr) {
+	switch size {
+	case 1:
+		w.Uint8(uint8(n))
+	case 2:
+		w.Uint16(uint16(n))
+	case 4:
+		w.Uint32(uint32(n))
+	default:
+		w.Uint64(n)
+	}
+}
+
+func (r *BinaryReader) fixedUint(size uintptr) (uint64, error) {
+	switch size {
+	case 1:
+		n, err := r.Uint8()
+		return uint64(n), err
+	case 2:
+		n, err := r.Uint16()
+		return uint64(n), err
+	case 4:
+		n, err := r.Uint32()
+		return uint64(n), err
+	}
+	return r.Uint64()
+}
+
+func (r *BinaryReader) decode(v reflect.Value, fixed bool) error {
+	start := r.pos
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := r.Bool()
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if fixed {
+			u, err := r.fixedUint(v.Type().Size())
+			if err != nil {
+				return err
+			}
+			//Sign extend from the field's size
+			shift := 64 - 8*uint(v.Type().Size())
+			n = int64(u<<shift) >> shift
+		} else {
+			var err error
+			if n, err = r.Varint(); err != nil {
+				return err
+			}
+		}
+		if v.OverflowInt(n) {
+			return &DecodeError{"binary", start, "integer too large for " + v.Type().String()}
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		var err error
+		if fixed {
+			n, err = r.fixedUint(v.Type().Size())
+		} else {
+			n, err = r.Uvarint()
+		}
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(n) {
+			return &DecodeError{"binary", start, "integer too large for " + v.Type().String()}
+		}
+		v.SetUint(n)
+	case reflect.Float32:
+		n, err := r.Uint32()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(float64(math.Float32frombits(n)))
+	case reflect.Float64:
+		n, err := r.Uint64()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(math.Float64frombits(n))
+	case reflect.String:
+		s, err := r.String()
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := r.Bytes()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		n, err := r.length()
+		if err != nil {
+			return err
+		}
+		slice := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := r.decode(slice.Index(i), fixed); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := r.take(v.Len())
+			if err != nil {
+				return err
+			}
+			for i, c := range b {
+				v.Index(i).SetUint(uint64(c))
+			}
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := r.decode(v.Index(i), fixed); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		n, err := r.length()
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(v.Type(), n)
+		previous := []byte(nil)
+		for i := 0; i < n; i++ {
+			keyStart := r.pos
+			k := reflect.New(v.Type().Key()).Elem()
+			if err := r.decode(k, fixed); err != nil {
+				return err
+			}
+			//Keys must be in order, and not repeated, or the encoding isn't the only one
+			key := r.data[keyStart:r.pos]
+			if previous != nil && bytes.Compare(previous, key) >= 0 {
+				return &DecodeError{"binary", keyStart, "map keys out of order"}
+			}
+			previous = key
+			e := reflect.New(v.Type().Elem()).Elem()
+			if err := r.decode(e, fixed); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, e)
+		}
+		v.Set(m)
+	case reflect.Ptr:
+		present, err := r.Uint8()
+		if err != nil {
+			return err
+		}
+		switch present {
+		case 0:
+			v.Set(reflect.Zero(v.Type()))
+		case 1:
+			p := reflect.New(v.Type().Elem())
+			if err := r.decode(p.Elem(), fixed); err != nil {
+				return err
+			}
+			v.Set(p)
+		default:
+			return &DecodeError{"binary", start, "invalid pointer flag"}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" || field.Tag.Get("bin") == "-" {
+				continue
+			}
+			if err := r.decode(v.Field(i), binaryFixed(field)); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("cannot decode type " + v.Type().String())
+	}
+	return nil
+}
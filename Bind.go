@@ -0,0 +1,273 @@
+package wiz
+
+import (
+	"encoding"
+	"github.com/pkg/errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//		Filling a struct from string keys and values: query strings, form
+//			posts, environment variables, parsed command line flags.
+
+//		Each exported field is read from the key named in its bind tag, or
+//			from its own name. Keys match case-insensitively (an exact match wins).
+//				Port    int           `bind:"port,required"`
+//				Timeout time.Duration `bind:"timeout" default:"30s"`
+//				Tags    []string      `bind:"tag"`
+//				Secret  string        `bind:"-"`	//Never bound
+//			A missing (or empty) key leaves the field alone, unless there is a
+//			default tag, which is used as though it were the value. Required
+//			fields must be present and non-empty; defaults don't count.
+
+//		Supported field types: strings, ints, uints, floats, bools (using the
+//			converters in Convert.go, so "0x1F", "1_000" and "yes" work, and
+//			overflow for the field's size is an error), time.Duration, anything
+//			implementing encoding.TextUnmarshaler (time.Time, UUID, ...),
+//			pointers to any of these (allocated only when there is a value), and
+//			slices of them. A slice takes every value of a repeated url.Values
+//			key, or splits a single value at commas.
+
+//		Nested structs read prefixed keys: field Port in field DB is "db.port".
+//			Embedded structs without a bind tag share their parent's keys.
+
+//		All fields are attempted before returning, and every problem is listed
+//			in one *BindError. Fields that failed are left as they were.
+
+// Problems found by Bind, one per field
+type BindError struct {
+	Fields []BindFieldError
+}
+
+// A field Bind could not fill. Field is the key it was read from.
+type BindFieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *BindError) Error() string {
+	problems := []string{}
+	for _, f := range e.Fields {
+		problems = append(problems, f.Field+": "+f.Err.Error())
+	}
+	return "wiz.Bind: " + strings.Join(problems, "; ")
+}
+
+// Fills a struct (passed as a pointer) from a map[string]string, map[string][]string or url.Values. See top of Bind.go.
+func Bind(values interface{}, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("wiz.Bind: target must be a non-nil pointer to a struct")
+	}
+	var lookup bindLookup
+	switch m := values.(type) {
+	case map[string]string:
+		lookup = newBindLookup(len(m))
+		for k, v := range m {
+			lookup.add(k, []string{v})
+		}
+	case url.Values:
+		lookup = newBindLookup(len(m))
+		for k, v := range m {
+			lookup.add(k, v)
+		}
+	case map[string][]string:
+		lookup = newBindLookup(len(m))
+		for k, v := range m {
+			lookup.add(k, v)
+		}
+	case nil:
+		return errors.New("wiz.Bind: values is nil")
+	default:
+		return errors.New("wiz.Bind: cannot read values from type " + reflect.TypeOf(values).String())
+	}
+	problems := &BindError{}
+	bindStruct(v.Elem(), "", lookup, problems)
+	if len(problems.Fields) > 0 {
+		return problems
+	}
+	return nil
+}
+
+//
+//
+//
+//
+//
+
+type bindLookup struct {
+	exact map[string][]string
+	lower map[string][]string
+}
+
+func newBindLookup(size int) bindLookup {
+	return bindLookup{make(map[string][]string, size), make(map[string][]string, size)}
+}
+
+func (l bindLookup) add(key string, values []string) {
+	l.exact[key] = values
+	l.lower[strings.ToLower(key)] = values
+}
+
+// Returns the non-empty values for a key
+func (l bindLookup) get(key string) []string {
+	values, ok := l.exact[key]
+	if !ok {
+		values = l.lower[strings.ToLower(key)]
+	}
+	nonEmpty := []string{}
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			nonEmpty = append(nonEmpty, v)
+		}
+	}
+	return nonEmpty
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func bindStruct(v reflect.Value, prefix string, lookup bindLookup, problems *BindError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, fv := t.Field(i), v.Field(i)
+		if field.PkgPath != "" {
+			continue //Unexported
+		}
+		tag := field.Tag.Get("bind")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name, required := parts[0], false
+		for _, option := range parts[1:] {
+			required = required || strings.TrimSpace(option) == "required"
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if nestedStruct(fv.Type()) {
+			if field.Anonymous && tag == "" {
+				bindStruct(fv, prefix, lookup, problems)
+			} else {
+				bindStruct(fv, prefix+name+".", lookup, problems)
+			}
+			continue
+		}
+		key := prefix + name
+		values := lookup.get(key)
+		if len(values) == 0 {
+			def, hasDefault := field.Tag.Lookup("default")
+			switch {
+			case required:
+				problems.Fields = append(problems.Fields, BindFieldError{key, errors.New("required")})
+				continue
+			case !hasDefault:
+				continue
+			}
+			values = []string{def}
+		}
+		if err := bindField(fv, values); err != nil {
+			problems.Fields = append(problems.Fields, BindFieldError{key, err})
+		}
+	}
+}
+
+// Structs that are bound field by field, rather than from a single value
+func nestedStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// Sets a field from one or more values, leaving it unchanged on error
+func bindField(fv reflect.Value, values []string) error {
+	if fv.Kind() != reflect.Slice || fv.Type().Elem().Kind() == reflect.Uint8 || fv.Addr().Type().Implements(textUnmarshalerType) {
+		n := reflect.New(fv.Type()).Elem()
+		if err := bindValue(n, values[0]); err != nil {
+			return err
+		}
+		fv.Set(n)
+		return nil
+	}
+	items := values
+	if len(values) == 1 {
+		items = strings.Split(values[0], ",")
+	}
+	slice := reflect.MakeSlice(fv.Type(), len(items), len(items))
+	for i, item := range items {
+		if err := bindValue(slice.Index(i), strings.TrimSpace(item)); err != nil {
+			return err
+		}
+	}
+	fv.Set(slice)
+	return nil
+}
+
+// Sets an addressable value from a string
+func bindValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		n := reflect.New(v.Type().Elem())
+		if err := bindValue(n.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(n)
+		return nil
+	}
+	if v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if v.Type() == durationType {
+		d, err := Duration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return errors.New("unsupported field type " + v.Type().String())
+		}
+		v.SetBytes([]byte(s))
+	case reflect.Bool:
+		b, err := Bool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := Int64(s)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(n) {
+			return &ConversionError{"Bind", s, ErrConversionRange}
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := Uint64(s)
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(n) {
+			return &ConversionError{"Bind", s, ErrConversionRange}
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := Float64(s)
+		if err != nil {
+			return err
+		}
+		if v.OverflowFloat(f) {
+			return &ConversionError{"Bind", s, ErrConversionRange}
+		}
+		v.SetFloat(f)
+	default:
+		return errors.New("unsupported field type " + v.Type().String())
+	}
+	return nil
+}
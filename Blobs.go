@@ -0,0 +1,252 @@
+package wiz
+
+import (
+	"github.com/pkg/errors"
+	sha3 "golang.org/x/crypto/sha3"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+//		Content-addressed blob store on disk.
+
+//		Blobs are stored under their digest, which is the uppercase hex of their
+//			Hash (SHA3-512, so 128 hex characters). Writing the same data twice
+//			stores it once. Files are sharded into two levels of subdirectories
+//			using the first four characters of the digest, so that no single
+//			directory ends up holding every blob:
+//				<root>/AB/CD/ABCD...
+
+//		Writes go to a temporary file first and are renamed into place, so a
+//			blob is either fully present or absent, even after a crash. Reads
+//			re-hash the contents and fail if they no longer match the digest.
+
+//		Digests passed to methods are case-insensitive.
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+//		Simple example:
+//		s, err := NewBlobStore("uploads")
+//		digest, err := s.Put([]byte("some file"))
+//		data, err := s.Get(digest)
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+// Content-addressed store of blobs, rooted at a directory
+type BlobStore struct {
+	root string
+}
+
+// Creates a BlobStore rooted at a given relative path (relative to Dir()). Creates the directory if needed.
+func NewBlobStore(dir string) (BlobStore, error) {
+	root := filepath.FromSlash(Dir() + dir)
+	err := os.MkdirAll(filepath.Join(root, "tmp"), 0755)
+	if err != nil {
+		return BlobStore{}, errors.Wrap(err, "wiz.NewBlobStore")
+	}
+	return BlobStore{root: root}, nil
+}
+
+// Stores a blob and returns its digest. Does nothing (except return the digest) if the blob is already stored.
+func (s *BlobStore) Put(data []byte) (string, error) {
+	digest := BytesToHex(Hash(data))
+	if s.Has(digest) {
+		return digest, nil
+	}
+	path := s.path(digest)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = writeFileAtomic(path, data)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "wiz.BlobStore.Put")
+	}
+	return digest, nil
+}
+
+// Streams a blob from a reader into the store and returns its digest. The data is hashed while it is written, so it is never held in memory all at once.
+func (s *BlobStore) PutReader(r io.Reader) (string, error) {
+	if r == nil {
+		return "", errors.New("wiz.BlobStore.PutReader: nil reader")
+	}
+	tmp, err := ioutil.TempFile(filepath.Join(s.root, "tmp"), "put-")
+	if err != nil {
+		return "", errors.Wrap(err, "wiz.BlobStore.PutReader")
+	}
+	defer os.Remove(tmp.Name()) //No-op once renamed
+	h := sha3.New512()
+	_, err = io.Copy(io.MultiWriter(tmp, h), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "wiz.BlobStore.PutReader")
+	}
+	digest := BytesToHex(h.Sum(nil))
+	if s.Has(digest) {
+		return digest, nil
+	}
+	path := s.path(digest)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "wiz.BlobStore.PutReader")
+	}
+	return digest, nil
+}
+
+// Returns true if a blob with a given digest is stored
+func (s *BlobStore) Has(digest string) bool {
+	digest, ok := normalizeDigest(digest)
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(s.path(digest))
+	return err == nil && !info.IsDir()
+}
+
+// Reads a blob by digest. Returns an error if the blob is missing or its contents no longer match the digest.
+func (s *BlobStore) Get(digest string) ([]byte, error) {
+	digest, ok := normalizeDigest(digest)
+	if !ok {
+		return []byte{}, errors.New("wiz.BlobStore.Get: invalid digest")
+	}
+	data, err := ioutil.ReadFile(s.path(digest))
+	if err != nil {
+		return []byte{}, errors.Wrap(err, "wiz.BlobStore.Get")
+	}
+	if BytesToHex(Hash(data)) != digest {
+		return []byte{}, errors.New("wiz.BlobStore.Get: integrity check failed for " + digest)
+	}
+	return data, nil
+}
+
+// Deletes a blob by digest. Deleting a blob that is not stored is not an error.
+func (s *BlobStore) Delete(digest string) error {
+	digest, ok := normalizeDigest(digest)
+	if !ok {
+		return errors.New("wiz.BlobStore.Delete: invalid digest")
+	}
+	path := s.path(digest)
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "wiz.BlobStore.Delete")
+	}
+	//Tidy up shard directories if they are now empty (fails harmlessly if not)
+	os.Remove(filepath.Dir(path))
+	os.Remove(filepath.Dir(filepath.Dir(path)))
+	return nil
+}
+
+// Returns the digests of all stored blobs, sorted
+func (s *BlobStore) List() ([]string, error) {
+	digests := []string{}
+	err := filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == filepath.Join(s.root, "tmp") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		digest, ok := normalizeDigest(info.Name())
+		if ok && s.path(digest) == path {
+			digests = append(digests, digest)
+		}
+		return nil
+	})
+	if err != nil {
+		return []string{}, errors.Wrap(err, "wiz.BlobStore.List")
+	}
+	sort.Strings(digests)
+	return digests, nil
+}
+
+// Garbage collection: deletes every stored blob whose digest is not in the live set. Returns the digests that were deleted.
+func (s *BlobStore) GC(live []string) ([]string, error) {
+	keep := map[string]bool{}
+	for _, d := range live {
+		if n, ok := normalizeDigest(d); ok {
+			keep[n] = true
+		}
+	}
+	all, err := s.List()
+	if err != nil {
+		return []string{}, errors.Wrap(err, "wiz.BlobStore.GC")
+	}
+	deleted := []string{}
+	for _, d := range all {
+		if keep[d] {
+			continue
+		}
+		err = s.Delete(d)
+		if err != nil {
+			return deleted, errors.Wrap(err, "wiz.BlobStore.GC")
+		}
+		deleted = append(deleted, d)
+	}
+	return deleted, nil
+}
+
+//
+//
+//
+//
+//
+
+// Sharded location of a (normalized) digest
+func (s *BlobStore) path(digest string) string {
+	return filepath.Join(s.root, digest[0:2], digest[2:4], digest)
+}
+
+// Uppercases a digest and checks that it is 128 hex characters
+func normalizeDigest(digest string) (string, bool) {
+	if len(digest) != 128 {
+		return "", false
+	}
+	digest = Uppercase(digest)
+	for _, c := range digest {
+		if !(c >= '0' && c <= '9') && !(c >= 'A' && c <= 'F') {
+			return "", false
+		}
+	}
+	return digest, true
+}
+
+// Writes a file by writing a temporary file in the same directory, syncing it
+// and renaming it over the destination. Readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //No-op once renamed
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
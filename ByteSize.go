@@ -0,0 +1,124 @@
+package wiz
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+//		Byte sizes for people: "10MiB", "1.5 GB", "512".
+
+//		ParseBytes ignores case and whitespace. A unit containing an i is IEC
+//			(powers of 1024), anything else is SI (powers of 1000):
+//				B						1
+//				K, KB, M, MB, G, GB		1000, 1000^2, 1000^3 (also T, P, E)
+//				Ki, KiB, Mi, MiB, ...	1024, 1024^2, ...
+//			So "10m" and "10MB" are both 10,000,000. Fractions are allowed
+//			("1.5GiB"); any fraction of a byte left over is dropped. Errors are
+//			*ConversionError, as from Uint64, which uses ParseBytes when asked:
+//				Uint64With("10MiB", ConvertOptions{ByteSizes: true})
+
+//		FormatBytes picks the largest unit that keeps the number at least 1:
+//			FormatBytes(1572864, IECUnits, 1) = "1.5 MiB"
+//			FormatBytes(1572864, SIUnits, 2) = "1.57 MB"
+//			FormatBytes(512, SIUnits, 2) = "512 B"
+
+// Unit system for FormatBytes
+type ByteUnits int
+
+const (
+	SIUnits  ByteUnits = iota //kB, MB, GB, ... (powers of 1000)
+	IECUnits                  //KiB, MiB, GiB, ... (powers of 1024)
+)
+
+// Parses a byte size such as "10MiB" or "1.5 GB" (see top of ByteSize.go)
+func ParseBytes(s string) (uint64, error) {
+	fail := func(err error) (uint64, error) { return 0, &ConversionError{"ParseBytes", s, err} }
+	trimmed := strings.TrimSpace(s)
+	end := 0
+	for end < len(trimmed) && (trimmed[end] >= '0' && trimmed[end] <= '9' || trimmed[end] == '.') {
+		end++
+	}
+	number, unit := trimmed[:end], strings.ToLower(strings.TrimSpace(trimmed[end:]))
+	multiplier, ok := byteMultipliers[unit]
+	if !ok || number == "" || number == "." || strings.Count(number, ".") > 1 {
+		return fail(ErrConversionSyntax)
+	}
+	whole, fraction := number, ""
+	if dot := strings.IndexByte(number, '.'); dot >= 0 {
+		whole, fraction = number[:dot], number[dot+1:]
+	}
+	n := uint64(0)
+	if whole != "" {
+		var err error
+		n, err = strconv.ParseUint(whole, 10, 64)
+		if err != nil || n > math.MaxUint64/multiplier {
+			return fail(ErrConversionRange)
+		}
+	}
+	n *= multiplier
+	//Add the fraction exactly: digit by digit, as numerator over a power of ten
+	numerator, denominator := uint64(0), uint64(1)
+	for i := 0; i < len(fraction) && denominator < 1e18; i++ {
+		numerator = numerator*10 + uint64(fraction[i]-'0')
+		denominator *= 10
+	}
+	if numerator > 0 {
+		extra := mulDiv(numerator, multiplier, denominator)
+		if extra > math.MaxUint64-n {
+			return fail(ErrConversionRange)
+		}
+		n += extra
+	}
+	return n, nil
+}
+
+// Formats a byte size with a given number of decimal places (see top of ByteSize.go)
+func FormatBytes(n uint64, units ByteUnits, precision int) string {
+	base, names := 1000.0, []string{"B", "kB", "MB", "GB", "TB", "PB", "EB"}
+	if units == IECUnits {
+		base, names = 1024.0, []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	}
+	if precision < 0 {
+		precision = 0
+	}
+	if float64(n) < base {
+		return strconv.FormatUint(n, 10) + " B"
+	}
+	value, i := float64(n), 0
+	for i < len(names)-1 && value >= base {
+		value /= base
+		i++
+	}
+	text := strconv.FormatFloat(value, 'f', precision, 64)
+	//Rounding can reach the next unit: 1023.96 KiB at precision 1 is 1.0 MiB, not 1024.0 KiB
+	if rounded, _ := strconv.ParseFloat(text, 64); rounded >= base && i < len(names)-1 {
+		text = strconv.FormatFloat(rounded/base, 'f', precision, 64)
+		i++
+	}
+	return text + " " + names[i]
+}
+
+//
+//
+//
+//
+//
+
+var byteMultipliers = map[string]uint64{
+	"": 1, "b": 1,
+	"k": 1e3, "kb": 1e3, "ki": 1 << 10, "kib": 1 << 10,
+	"m": 1e6, "mb": 1e6, "mi": 1 << 20, "mib": 1 << 20,
+	"g": 1e9, "gb": 1e9, "gi": 1 << 30, "gib": 1 << 30,
+	"t": 1e12, "tb": 1e12, "ti": 1 << 40, "tib": 1 << 40,
+	"p": 1e15, "pb": 1e15, "pi": 1 << 50, "pib": 1 << 50,
+	"e": 1e18, "eb": 1e18, "ei": 1 << 60, "eib": 1 << 60,
+}
+
+// Returns a*b/c for c > a without overflowing, rounding down
+func mulDiv(a, b, c uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	q, _ := bits.Div64(hi, lo, c) //hi < c because a < c, so this can't panic
+	return q
+}
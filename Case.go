@@ -0,0 +1,143 @@
+package wiz
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//		Converting identifiers and text between naming styles, and making URL
+//			and file name slugs.
+
+//		Input is split into words at spaces, punctuation and changes of case,
+//			so any style converts to any other:
+//				"userID", "UserId", "user_id", "user-id" and "USER ID"
+//					SnakeCase: "user_id"		CamelCase: "userId"
+//					KebabCase: "user-id"		PascalCase: "UserId"
+//					ScreamingCase: "USER_ID"
+//			A run of capitals is one word (an acronym), ending before a capital
+//			followed by lowercase: "HTTPServer" is "HTTP" and "Server". Digits
+//			stay with the word before them, and a capital after digits starts a
+//			new word: "base64Encode" is "base64" and "Encode". Acronyms are
+//			not kept in capitals (PascalCase gives "HttpServer").
+
+//		Slugify makes text safe for URLs and file names: "Crème Brûlée: 2 ways!"
+//			becomes "creme-brulee-2-ways". Latin accents are converted by
+//			ToASCII; other characters that aren't ASCII letters or digits are
+//			removed, and runs of everything else become a single dash.
+
+// Splits text into words (see top of Case.go)
+func SplitWords(s string) []string {
+	words := []string{}
+	runes := []rune(s)
+	start := -1
+	for i, r := range runes {
+		if !wordRune(r) {
+			if start >= 0 {
+				words = append(words, string(runes[start:i]))
+				start = -1
+			}
+			continue
+		}
+		if start >= 0 && wordBoundary(runes, i) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// Converts to camelCase
+func CamelCase(s string) string {
+	words := SplitWords(s)
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+		if i > 0 {
+			words[i] = capitalize(words[i])
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// Converts to PascalCase
+func PascalCase(s string) string {
+	words := SplitWords(s)
+	for i, w := range words {
+		words[i] = capitalize(strings.ToLower(w))
+	}
+	return strings.Join(words, "")
+}
+
+// Converts to snake_case
+func SnakeCase(s string) string {
+	return strings.ToLower(strings.Join(SplitWords(s), "_"))
+}
+
+// Converts to kebab-case
+func KebabCase(s string) string {
+	return strings.ToLower(strings.Join(SplitWords(s), "-"))
+}
+
+// Converts to SCREAMING_CASE
+func ScreamingCase(s string) string {
+	return strings.ToUpper(strings.Join(SplitWords(s), "_"))
+}
+
+// Converts text to a lowercase ASCII slug for URLs and file names (see top of Case.go)
+func Slugify(s string) string {
+	s = strings.NewReplacer("'", "", "’", "").Replace(s) //"Don't" is "dont", not "don-t"
+	b := strings.Builder{}
+	dash := false
+	for _, c := range []byte(strings.ToLower(ToASCII(s))) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteByte(c)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+//
+//
+//
+//
+//
+
+// Letters, digits, and combining accents (which belong to the letter before them)
+func wordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// True if a new word starts at runes[i], continuing a word that includes runes[i-1]
+func wordBoundary(runes []rune, i int) bool {
+	if !unicode.IsUpper(runes[i]) {
+		return false
+	}
+	prev := runes[i-1]
+	switch {
+	case unicode.IsLower(prev), unicode.IsDigit(prev):
+		return true
+	case unicode.IsUpper(prev):
+		return i+1 < len(runes) && unicode.IsLower(runes[i+1])
+	}
+	return false
+}
+
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
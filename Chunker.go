@@ -0,0 +1,142 @@
+package wiz
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+	"math/bits"
+)
+
+//		Content-defined chunking (FastCDC).
+
+//		Splits a stream into chunks whose boundaries depend on the content
+//			rather than on fixed offsets. Inserting a byte at the start of a file
+//			only changes the first chunk, instead of shifting every chunk after
+//			it, which is what makes deduplication of mostly-unchanged files work.
+
+//		A rolling "gear" hash is computed over the bytes and a boundary is placed
+//			where its top bits are all zero. Between the min and average size a
+//			stricter mask is used, and after the average a looser one, which
+//			keeps chunk sizes close to the average (normalized chunking).
+
+//		The gear table is derived from Hash, so boundaries are stable forever.
+
+//		Reference: Xia et al, "FastCDC: a Fast and Efficient Content-Defined
+//			Chunking Approach for Data Deduplication" (USENIX ATC 2016)
+
+// Splits a reader into content-defined chunks
+type Chunker struct {
+	r            io.Reader
+	buf          []byte
+	start, end   int
+	eof          bool
+	min, avg     int
+	maskS, maskL uint64
+}
+
+// Creates a Chunker with given minimum, average and maximum chunk sizes in bytes. Average must be a power of two. Backups use 2 KiB, 8 KiB and 64 KiB.
+func NewChunker(r io.Reader, min, avg, max int) (*Chunker, error) {
+	if r == nil {
+		return nil, errors.New("wiz.NewChunker: nil reader")
+	}
+	if min < 64 || min >= avg || avg >= max {
+		return nil, errors.New("wiz.NewChunker: sizes must satisfy 64 <= min < avg < max")
+	}
+	if avg&(avg-1) != 0 {
+		return nil, errors.New("wiz.NewChunker: average size must be a power of two")
+	}
+	b := bits.TrailingZeros(uint(avg))
+	return &Chunker{
+		r:     r,
+		buf:   make([]byte, max),
+		min:   min,
+		avg:   avg,
+		maskS: topBits(b + 2),
+		maskL: topBits(b - 2),
+	}, nil
+}
+
+// Returns the next chunk, or io.EOF when the reader is exhausted. The returned slice is a copy and safe to keep.
+func (c *Chunker) Next() ([]byte, error) {
+	err := c.fill()
+	if err != nil {
+		return []byte{}, errors.Wrap(err, "wiz.Chunker.Next")
+	}
+	if c.end == c.start {
+		return []byte{}, io.EOF
+	}
+	data := c.buf[c.start:c.end]
+	n := c.cut(data)
+	chunk := make([]byte, n)
+	copy(chunk, data[:n])
+	c.start += n
+	return chunk, nil
+}
+
+//
+//
+//
+//
+//
+
+// Moves unconsumed bytes to the front of buf and reads until it is full or EOF
+func (c *Chunker) fill() error {
+	if c.start > 0 {
+		c.end = copy(c.buf, c.buf[c.start:c.end])
+		c.start = 0
+	}
+	for !c.eof && c.end < len(c.buf) {
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+		if err == io.EOF {
+			c.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the length of the first chunk in data (data is at most max bytes)
+func (c *Chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.min {
+		return n
+	}
+	normal := c.avg
+	if n < normal {
+		normal = n
+	}
+	fp := uint64(0)
+	i := c.min
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// Mask of the n most significant bits. High bits of the gear hash depend on
+// the most recent 64 bytes, low bits only on the last few.
+func topBits(n int) uint64 {
+	return ^uint64(0) << uint(64-n)
+}
+
+var gearTable = makeGearTable()
+
+func makeGearTable() [256]uint64 {
+	table := [256]uint64{}
+	for i := range table {
+		h := Hash([]byte{'w', 'i', 'z', 'g', 'e', 'a', 'r', byte(i)})
+		table[i] = binary.BigEndian.Uint64(h[:8])
+	}
+	return table
+}
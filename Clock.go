@@ -0,0 +1,299 @@
+package wiz
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//		Injectable clock, so that code which waits can be tested without waiting.
+
+//		Now, Sleep, the ID generators, Ledger timestamps and anything else in wiz
+//			that asks for the time use the current Clock, which is the real one
+//			unless swapped with SetClock. Types that wait (schedulers, limiters,
+//			retries) also take a Clock directly, and NowOn, SleepOn, AgoOn,
+//			UntilOn and VerifyTOTPAt take one (or a time) as an argument.
+//			Prefer those in tests: passing a clock only affects that call.
+
+//		SetClock works like SetRandomSource: it holds a lock until its restore
+//			function is called, so tests that swap clocks take turns. The swap is
+//			for the whole process, not just the test that made it:
+//			- Sleep on any goroutine (another test, a library) blocks until
+//				someone advances the FakeClock, which may be never.
+//			- Schedulers, limiters and retries made with a nil Clock while the
+//				swap is in place keep the FakeClock after restore.
+//			- Calling SetClock again before restoring deadlocks.
+
+//		A FakeClock only moves when told to (Advance or Set). Sleepers, timers
+//			and tickers fire during Advance, in order of their due time, and the
+//			clock reads exactly their due time while they fire. BlockUntil lets
+//			a test wait until the code under test is actually sleeping before
+//			advancing, which removes the race between "start sleeping" and
+//			"advance the clock".
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+//		Example:
+//		clock := NewFakeClock(time.Unix(0, 0))
+//		go func() { SleepOn(clock, 60); done <- true }()
+//		clock.BlockUntil(1)			//Goroutine is now sleeping
+//		clock.Advance(time.Minute)	//Wakes it
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+// Source of time and waiting
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer made by a Clock. Same semantics as time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker made by a Clock. Same semantics as time.Ticker (slow receivers miss ticks).
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Returns the clock backed by the time package
+func RealClock() Clock {
+	return realClock{}
+}
+
+// Replaces the clock used by Now, Sleep and friends, for every goroutine (see top of Clock.go). Call the returned function to put the previous clock back.
+func SetClock(c Clock) (restore func()) {
+	clockScope.Lock()
+	clockLock.Lock()
+	previous := clock
+	clock = c
+	clockLock.Unlock()
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			clockLock.Lock()
+			clock = previous
+			clockLock.Unlock()
+			clockScope.Unlock()
+		})
+	}
+}
+
+// Clock that only moves when told to
+type FakeClock struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+	serial  uint64
+}
+
+// Creates a FakeClock reading a given time
+func NewFakeClock(start time.Time) *FakeClock {
+	f := &FakeClock{now: start}
+	f.cond = sync.NewCond(&f.lock)
+	return f
+}
+
+// Returns the fake time
+func (f *FakeClock) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// Blocks until the clock has been advanced by d
+func (f *FakeClock) Sleep(d time.Duration) {
+	<-f.NewTimer(d).C()
+}
+
+// Returns a channel that receives the time once the clock has been advanced by d
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// Returns a timer that fires once the clock has been advanced by d
+func (f *FakeClock) NewTimer(d time.Duration) Timer {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	w := &fakeWaiter{clock: f, c: make(chan time.Time, 1)}
+	f.schedule(w, d)
+	return w
+}
+
+// Returns a ticker that fires every time the clock passes another multiple of d. Panics if d is not positive, like time.NewTicker.
+func (f *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("wiz.FakeClock.NewTicker: non-positive interval")
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	w := &fakeWaiter{clock: f, c: make(chan time.Time, 1), period: d}
+	f.schedule(w, d)
+	return fakeTicker{w}
+}
+
+// Moves the clock forward, firing every timer, ticker and sleeper that comes due, in order
+func (f *FakeClock) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.advanceTo(f.now.Add(d))
+}
+
+// Moves the clock to a given time (only forwards), firing anything that comes due
+func (f *FakeClock) Set(t time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if t.After(f.now) {
+		f.advanceTo(t)
+	}
+}
+
+// Returns the number of pending sleepers, timers and tickers
+func (f *FakeClock) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.waiters)
+}
+
+// Blocks until at least n sleepers, timers and tickers are pending
+func (f *FakeClock) BlockUntil(n int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+//
+//
+//
+//
+//
+
+var clockScope sync.Mutex //Held while a swapped clock is in place
+var clockLock sync.RWMutex
+var clock = RealClock()
+
+func currentClock() Clock {
+	clockLock.RLock()
+	defer clockLock.RUnlock()
+	return clock
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (r realTimer) C() <-chan time.Time        { return r.t.C }
+func (r realTimer) Stop() bool                 { return r.t.Stop() }
+func (r realTimer) Reset(d time.Duration) bool { return r.t.Reset(d) }
+
+type realTicker struct{ t *time.Ticker }
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+func (r realTicker) Stop()               { r.t.Stop() }
+
+// A FakeClock timer or ticker (period > 0)
+type fakeWaiter struct {
+	clock  *FakeClock
+	c      chan time.Time
+	when   time.Time
+	period time.Duration
+	serial uint64 //Breaks ties between waiters due at the same time
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.clock.lock.Lock()
+	defer w.clock.lock.Unlock()
+	return w.clock.remove(w)
+}
+
+// Ticker view of a fakeWaiter (Stop returns nothing)
+type fakeTicker struct{ w *fakeWaiter }
+
+func (t fakeTicker) C() <-chan time.Time { return t.w.c }
+func (t fakeTicker) Stop()               { t.w.Stop() }
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	w.clock.lock.Lock()
+	defer w.clock.lock.Unlock()
+	active := w.clock.remove(w)
+	w.clock.schedule(w, d)
+	return active
+}
+
+// Caller holds lock. Fires immediately if d is not positive.
+func (f *FakeClock) schedule(w *fakeWaiter, d time.Duration) {
+	w.when = f.now.Add(d)
+	if d <= 0 && w.period == 0 {
+		w.fire(f.now)
+		return
+	}
+	f.serial++
+	w.serial = f.serial
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+}
+
+// Caller holds lock. Returns true if w was pending.
+func (f *FakeClock) remove(w *fakeWaiter) bool {
+	for i, other := range f.waiters {
+		if other == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Caller holds lock
+func (f *FakeClock) advanceTo(target time.Time) {
+	for {
+		sort.Slice(f.waiters, func(i, j int) bool {
+			a, b := f.waiters[i], f.waiters[j]
+			if a.when.Equal(b.when) {
+				return a.serial < b.serial
+			}
+			return a.when.Before(b.when)
+		})
+		if len(f.waiters) == 0 || f.waiters[0].when.After(target) {
+			break
+		}
+		w := f.waiters[0]
+		f.waiters = f.waiters[1:]
+		f.now = w.when
+		w.fire(f.now)
+		if w.period > 0 {
+			f.schedule(w, w.period)
+		}
+	}
+	f.now = target
+}
+
+// Non-blocking send, like the time package: a full channel means the tick is dropped
+func (w *fakeWaiter) fire(t time.Time) {
+	select {
+	case w.c <- t:
+	default:
+	}
+}
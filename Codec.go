@@ -0,0 +1,357 @@
+package wiz
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"github.com/pkg/errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//		Binary-to-text encodings, and a registry to select one by name.
+
+//		Names understood by GetCodec (e.g. from a config file):
+//			"hex"				Uppercase hex, like BytesToHex (decoding is case-insensitive)
+//			"base32"			RFC 4648, padded
+//			"base32raw"			RFC 4648, unpadded
+//			"crockford"			Crockford base32 (case-insensitive, I/L read as 1, O as 0, hyphens ignored)
+//			"base58"			Bitcoin alphabet
+//			"base58check"		Base58 with a 4 byte double SHA-256 checksum (Bitcoin compatible)
+//			"base64"			RFC 4648 standard alphabet, padded
+//			"base64raw"			RFC 4648 standard alphabet, unpadded
+//			"base64url"			RFC 4648 URL-safe alphabet, padded
+//			"base64urlraw"		RFC 4648 URL-safe alphabet, unpadded
+//			"bech32:<hrp>"		BIP 173 bech32 with a given human readable part, e.g. "bech32:bc"
+//			"bech32m:<hrp>"		BIP 350 bech32m with a given human readable part
+//		More can be added with RegisterCodec.
+
+//		Decoders return a *DecodeError when the input contains an invalid
+//			character, which says where (byte offset into the input string).
+//			Inputs that are the wrong length report the offset of the end.
+//			Exported decoders wrap it with their name, like other wiz errors
+//			("wiz.HexToBytes: ..."), so use errors.Cause to get at it:
+//				if d, ok := errors.Cause(err).(*DecodeError); ok { ... d.Offset ... }
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+//		Example:
+//		c, err := GetCodec(config.KeyEncoding) //e.g. "base58"
+//		s := c.Encode(publicKey)
+//		b, err := c.Decode(s)
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+// A named binary-to-text encoding
+type Codec interface {
+	Encode(data []byte) string
+	Decode(s string) ([]byte, error)
+}
+
+// Error describing invalid input to a decoder. Offset is a byte offset into the input.
+type DecodeError struct {
+	Encoding string
+	Offset   int
+	Reason   string
+}
+
+func (e *DecodeError) Error() string {
+	return "wiz: invalid " + e.Encoding + " input at offset " + strconv.Itoa(e.Offset) + ": " + e.Reason
+}
+
+// Adds (or replaces) a codec under a given name. Names are case-insensitive.
+func RegisterCodec(name string, c Codec) {
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	codecs[Lowercase(name)] = c
+}
+
+// Returns the codec registered under a given name (case-insensitive). Also accepts "bech32:<hrp>" and "bech32m:<hrp>".
+func GetCodec(name string) (Codec, error) {
+	name = Lowercase(strings.TrimSpace(name))
+	for _, variant := range []string{"bech32:", "bech32m:"} {
+		if strings.HasPrefix(name, variant) {
+			hrp := name[len(variant):]
+			err := checkHRP(hrp)
+			if err != nil {
+				return nil, errors.Wrap(err, "wiz.GetCodec")
+			}
+			return bech32Codec{hrp: hrp, m: variant == "bech32m:"}, nil
+		}
+	}
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	c, ok := codecs[name]
+	if !ok {
+		return nil, errors.New("wiz.GetCodec: unknown codec " + strconv.Quote(name))
+	}
+	return c, nil
+}
+
+// Returns the names of all registered codecs, sorted
+func Codecs() []string {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	names := []string{}
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Encodes bytes as padded RFC 4648 base32
+func BytesToBase32(data []byte) string {
+	return base32.StdEncoding.EncodeToString(data)
+}
+
+// Decodes padded RFC 4648 base32 (uppercase)
+func Base32ToBytes(s string) ([]byte, error) {
+	b, err := decodeRFC4648(s, "base32", base32Alphabet, base32.StdEncoding, true)
+	return b, errors.Wrap(err, "wiz.Base32ToBytes")
+}
+
+// Encodes bytes as Crockford base32 (uppercase, unpadded)
+func BytesToCrockford(data []byte) string {
+	return crockfordEncoding.EncodeToString(data)
+}
+
+// Decodes Crockford base32. Case-insensitive, treats I and L as 1 and O as 0, and ignores hyphens.
+func CrockfordToBytes(s string) ([]byte, error) {
+	b, err := crockfordToBytes(s)
+	return b, errors.Wrap(err, "wiz.CrockfordToBytes")
+}
+
+// Encodes bytes as base58 (Bitcoin alphabet). Leading zero bytes become leading '1's.
+func BytesToBase58(data []byte) string {
+	zeros := 0
+	for zeros < len(data) && data[zeros] == 0 {
+		zeros++
+	}
+	n := new(big.Int).SetBytes(data)
+	base := big.NewInt(58)
+	mod := new(big.Int)
+	out := []byte{}
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for i := 0; i < zeros; i++ {
+		out = append(out, '1')
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// Decodes base58 (Bitcoin alphabet)
+func Base58ToBytes(s string) ([]byte, error) {
+	b, err := base58ToBytes(s, "base58")
+	return b, errors.Wrap(err, "wiz.Base58ToBytes")
+}
+
+// Encodes bytes as base58 with a 4 byte checksum appended (first 4 bytes of double SHA-256, as in Bitcoin)
+func BytesToBase58Check(data []byte) string {
+	return BytesToBase58(append(append([]byte{}, data...), base58Checksum(data)...))
+}
+
+// Decodes base58 with a checksum, returning an error if the checksum does not match
+func Base58CheckToBytes(s string) ([]byte, error) {
+	b, err := base58ToBytes(s, "base58check")
+	if err != nil {
+		return []byte{}, errors.Wrap(err, "wiz.Base58CheckToBytes")
+	}
+	if len(b) < 4 {
+		return []byte{}, errors.Wrap(&DecodeError{"base58check", len(s), "too short for checksum"}, "wiz.Base58CheckToBytes")
+	}
+	data, sum := b[:len(b)-4], b[len(b)-4:]
+	if string(sum) != string(base58Checksum(data)) {
+		return []byte{}, errors.New("wiz.Base58CheckToBytes: checksum mismatch")
+	}
+	return data, nil
+}
+
+// Encodes bytes as padded RFC 4648 base64 (standard alphabet)
+func BytesToBase64(data []byte) string {
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// Decodes padded RFC 4648 base64 (standard alphabet)
+func Base64ToBytes(s string) ([]byte, error) {
+	b, err := decodeRFC4648(s, "base64", base64Alphabet, base64.StdEncoding, true)
+	return b, errors.Wrap(err, "wiz.Base64ToBytes")
+}
+
+// Encodes bytes as unpadded RFC 4648 base64 (URL-safe alphabet)
+func BytesToBase64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decodes unpadded RFC 4648 base64 (URL-safe alphabet)
+func Base64URLToBytes(s string) ([]byte, error) {
+	b, err := decodeRFC4648(s, "base64url", base64URLAlphabet, base64.RawURLEncoding, false)
+	return b, errors.Wrap(err, "wiz.Base64URLToBytes")
+}
+
+//
+//
+//
+//
+//
+
+const base32Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+const base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+var crockfordEncoding = base32.NewEncoding(crockfordAlphabet).WithPadding(base32.NoPadding)
+
+var codecLock sync.RWMutex
+var codecs = map[string]Codec{
+	"hex":          codec{BytesToHex, HexToBytes},
+	"base32":       codec{BytesToBase32, Base32ToBytes},
+	"base32raw":    codec{base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString, base32RawToBytes},
+	"crockford":    codec{BytesToCrockford, CrockfordToBytes},
+	"base58":       codec{BytesToBase58, Base58ToBytes},
+	"base58check":  codec{BytesToBase58Check, Base58CheckToBytes},
+	"base64":       codec{BytesToBase64, Base64ToBytes},
+	"base64raw":    codec{base64.RawStdEncoding.EncodeToString, base64RawToBytes},
+	"base64url":    codec{base64.URLEncoding.EncodeToString, base64URLPaddedToBytes},
+	"base64urlraw": codec{BytesToBase64URL, Base64URLToBytes},
+}
+
+// Codec made from a pair of functions
+type codec struct {
+	encode func([]byte) string
+	decode func(string) ([]byte, error)
+}
+
+func (c codec) Encode(data []byte) string {
+	return c.encode(data)
+}
+
+func (c codec) Decode(s string) ([]byte, error) {
+	return c.decode(s)
+}
+
+func base32RawToBytes(s string) ([]byte, error) {
+	return decodeRFC4648(s, "base32raw", base32Alphabet, base32.StdEncoding.WithPadding(base32.NoPadding), false)
+}
+
+func base64RawToBytes(s string) ([]byte, error) {
+	return decodeRFC4648(s, "base64raw", base64Alphabet, base64.RawStdEncoding, false)
+}
+
+func base64URLPaddedToBytes(s string) ([]byte, error) {
+	return decodeRFC4648(s, "base64url", base64URLAlphabet, base64.URLEncoding, true)
+}
+
+func base58Checksum(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+// Anything with DecodeString, i.e. *base32.Encoding and *base64.Encoding
+type stringDecoder interface {
+	DecodeString(s string) ([]byte, error)
+}
+
+// Checks characters, padding and length of base32/base64 input before
+// decoding it, so that errors can say exactly where the problem is
+func decodeRFC4648(s, name, alphabet string, enc stringDecoder, padded bool) ([]byte, error) {
+	block, validPad, validRaw := 4, "012", "023"
+	if len(alphabet) == 32 {
+		block, validPad, validRaw = 8, "01346", "02457"
+	}
+	end := len(s)
+	if padded {
+		end = len(strings.TrimRight(s, "="))
+	}
+	for i := 0; i < end; i++ {
+		if strings.IndexByte(alphabet, s[i]) < 0 {
+			return []byte{}, &DecodeError{name, i, "invalid character " + strconv.QuoteRune(rune(s[i]))}
+		}
+	}
+	if padded {
+		if len(s)%block != 0 {
+			return []byte{}, &DecodeError{name, len(s), "length is not a multiple of " + strconv.Itoa(block)}
+		}
+		if !strings.ContainsRune(validPad, rune('0'+len(s)-end)) {
+			return []byte{}, &DecodeError{name, end, "invalid padding"}
+		}
+	} else if !strings.ContainsRune(validRaw, rune('0'+len(s)%block)) {
+		return []byte{}, &DecodeError{name, len(s), "invalid length"}
+	}
+	b, err := enc.DecodeString(s)
+	if err != nil {
+		offset := len(s)
+		if n, ok := err.(base64.CorruptInputError); ok {
+			offset = int(n)
+		} else if n, ok := err.(base32.CorruptInputError); ok {
+			offset = int(n)
+		}
+		return []byte{}, &DecodeError{name, offset, err.Error()}
+	}
+	return b, nil
+}
+
+// Decodes Crockford base32, with unprefixed errors
+func crockfordToBytes(s string) ([]byte, error) {
+	normal := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '-' {
+			continue
+		}
+		v := crockfordValue(s[i])
+		if v < 0 {
+			return []byte{}, &DecodeError{"crockford", i, "invalid character " + strconv.QuoteRune(rune(s[i]))}
+		}
+		normal = append(normal, crockfordAlphabet[v])
+	}
+	b, err := crockfordEncoding.DecodeString(string(normal))
+	if err != nil {
+		return []byte{}, &DecodeError{"crockford", len(s), "invalid length"}
+	}
+	return b, nil
+}
+
+// Decodes base58, with unprefixed errors naming the encoding as given
+func base58ToBytes(s, name string) ([]byte, error) {
+	n := new(big.Int)
+	base := big.NewInt(58)
+	zeros := 0
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(base58Alphabet, s[i])
+		if d < 0 {
+			return []byte{}, &DecodeError{name, i, "invalid character " + strconv.QuoteRune(rune(s[i]))}
+		}
+		if d == 0 && zeros == i {
+			zeros++
+		}
+		n.Mul(n, base)
+		n.Add(n, big.NewInt(int64(d)))
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+// Value of a Crockford base32 character (case-insensitive, with I/L/O aliases), or -1
+func crockfordValue(c byte) int {
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	switch c {
+	case 'I', 'L':
+		c = '1'
+	case 'O':
+		c = '0'
+	}
+	return strings.IndexByte(crockfordAlphabet, c)
+}
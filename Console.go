@@ -18,6 +18,9 @@ import (
 //			Prompt(prompt string) string
 //				Prompt console for input - silent hides it (like a password)
 
+//			SilentPromptSecret(prompt string) SecretBytes
+//				SilentPrompt, but the result can't be printed by accident and can be wiped
+
 //			Red(items ...interface{})
 //			Yellow(items ...interface{})
 //			Green(items ...interface{})
@@ -35,6 +38,13 @@ import (
 // Displays a prompt to the interface and returns what the user enters.
 // Hides user input from the console. Use for password entry for example.
 func SilentPrompt(prompt string) string {
+	secret := SilentPromptSecret(prompt)
+	defer secret.Wipe()
+	return string(secret.Reveal())
+}
+
+// Like SilentPrompt, but returns SecretBytes, which never prints and can be wiped after use.
+func SilentPromptSecret(prompt string) SecretBytes {
 	defer color.Unset()
 	color.Set(color.FgWhite, color.Bold)
 	fmt.Println(prompt)
@@ -42,7 +52,7 @@ func SilentPrompt(prompt string) string {
 	if err != nil {
 		panic(err)
 	}
-	return string(silentPassword)
+	return NewSecretBytes(silentPassword)
 }
 
 // Displays a prompt to the interface and returns what the user enters
@@ -153,3 +163,30 @@ func Print(items ...interface{}) {
 	}
 	fmt.Print("\n")
 }
+
+//
+//
+//
+//
+//
+
+// Returns s in blue, even when output is not a terminal (for HexDump)
+func blueString(s string) string {
+	return colorString(color.FgBlue, s)
+}
+
+// Returns s in green, even when output is not a terminal (for HexDump)
+func greenString(s string) string {
+	return colorString(color.FgGreen, s)
+}
+
+// Returns s in yellow, even when output is not a terminal (for HexDump)
+func yellowString(s string) string {
+	return colorString(color.FgYellow, s)
+}
+
+func colorString(attribute color.Attribute, s string) string {
+	c := color.New(attribute)
+	c.EnableColor()
+	return c.Sprint(s)
+}
@@ -0,0 +1,275 @@
+package wiz
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//		Converting loosely typed values (decoded JSON, config files, form
+//			input) to numbers, booleans and durations.
+
+//		Uint64, Int64, Float64, Bool and Duration all accept:
+//			- any integer or float type, and bool (as 1 or 0)
+//			- strings, including named string types such as json.Number:
+//				"42", "-7", "1_000_000", "0x2A", "0b101010", "0o52", "4.2e1"
+//				Surrounding whitespace is ignored. A leading 0 does not mean octal.
+//		Bool also accepts "true/false", "yes/no", "on/off", "y/n", "t/f" in
+//			any case, and numbers 0 and 1.
+//		Duration also accepts time.Duration, and strings for ParseDuration
+//			("1h30m", "2d"). Plain numbers are seconds, like Sleep.
+
+//		Nothing is silently changed. Conversions that would overflow, drop a
+//			fraction (2.5 to an integer), or round a large integer to the
+//			nearest float64 fail instead, with a *ConversionError:
+//				if errors.Cause(err) == ErrConversionLossy { ... }
+//		Float64 also rejects "NaN", "Inf" and non-finite floats (ErrConversionRange)
+//			unless asked for with Float64With and ConvertOptions{NonFinite: true}.
+
+// Describes a failed conversion. Err is one of the ErrConversion values.
+type ConversionError struct {
+	Func  string
+	Input interface{}
+	Err   error
+}
+
+// Reasons a conversion can fail
+var (
+	ErrConversionSyntax = errors.New("invalid syntax")
+	ErrConversionRange  = errors.New("out of range")
+	ErrConversionLossy  = errors.New("would lose precision")
+	ErrConversionType   = errors.New("unsupported type")
+)
+
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("wiz.%s: converting %T %#v: %s", e.Func, e.Input, e.Input, e.Err.Error())
+}
+
+// Returns Err, so errors.Cause finds the reason
+func (e *ConversionError) Cause() error {
+	return e.Err
+}
+
+// Returns Err, for the standard errors package
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+// Converts numbers, bools and strings to int64 (see top of Convert.go)
+func Int64(input interface{}) (int64, error) {
+	fail := func(err error) (int64, error) { return 0, &ConversionError{"Int64", input, err} }
+	n, err := toNumeric(input)
+	if err != nil {
+		return fail(err)
+	}
+	if n.isFloat {
+		if err := checkIntegral(n.f); err != nil {
+			return fail(err)
+		}
+		if n.f < -(1<<63) || n.f >= 1<<63 {
+			return fail(ErrConversionRange)
+		}
+		return int64(n.f), nil
+	}
+	switch {
+	case !n.neg && n.mag <= math.MaxInt64:
+		return int64(n.mag), nil
+	case n.neg && n.mag <= 1<<63:
+		return int64(-n.mag), nil //Wraps correctly for the most negative int64
+	}
+	return fail(ErrConversionRange)
+}
+
+// Converts numbers, bools and strings to float64 (see top of Convert.go). Integers too large to represent exactly are an error.
+func Float64(input interface{}) (float64, error) {
+	return Float64With(input, ConvertOptions{})
+}
+
+// Float64, with options. NonFinite allows NaN and infinities.
+func Float64With(input interface{}, opts ConvertOptions) (float64, error) {
+	fail := func(err error) (float64, error) { return 0, &ConversionError{"Float64", input, err} }
+	n, err := toNumeric(input)
+	if err != nil {
+		return fail(err)
+	}
+	if n.isFloat {
+		if !opts.NonFinite && (math.IsNaN(n.f) || math.IsInf(n.f, 0)) {
+			return fail(ErrConversionRange)
+		}
+		return n.f, nil
+	}
+	f := float64(n.mag)
+	if f >= 1<<64 || uint64(f) != n.mag {
+		return fail(ErrConversionLossy)
+	}
+	if n.neg {
+		f = -f
+	}
+	return f, nil
+}
+
+// Converts bools, the numbers 0 and 1, and strings such as "true", "yes", "off" or "0" to bool
+func Bool(input interface{}) (bool, error) {
+	fail := func(err error) (bool, error) { return false, &ConversionError{"Bool", input, err} }
+	v := reflect.ValueOf(input)
+	if v.Kind() == reflect.String {
+		switch strings.ToLower(strings.TrimSpace(v.String())) {
+		case "true", "t", "yes", "y", "on":
+			return true, nil
+		case "false", "f", "no", "n", "off":
+			return false, nil
+		}
+	}
+	n, err := toNumeric(input)
+	if err != nil {
+		return fail(err)
+	}
+	switch {
+	case n.isFloat && (n.f == 0 || n.f == 1):
+		return n.f == 1, nil
+	case !n.isFloat && n.mag <= 1 && !(n.neg && n.mag == 1):
+		return n.mag == 1, nil
+	}
+	return fail(ErrConversionRange)
+}
+
+// Converts time.Duration, duration strings ("1h30m", "2d") and numbers of seconds to time.Duration. Fractions of a nanosecond are rounded.
+func Duration(input interface{}) (time.Duration, error) {
+	fail := func(err error) (time.Duration, error) { return 0, &ConversionError{"Duration", input, err} }
+	if d, ok := input.(time.Duration); ok {
+		return d, nil
+	}
+	if v := reflect.ValueOf(input); v.Kind() == reflect.String {
+		if _, err := parseNumericString(v.String()); err != nil {
+			d, err := ParseDuration(strings.TrimSpace(v.String()))
+			if err != nil {
+				return fail(ErrConversionSyntax)
+			}
+			return d, nil
+		}
+	}
+	n, err := toNumeric(input)
+	if err != nil {
+		return fail(err)
+	}
+	if n.isFloat {
+		ns := math.Round(n.f * float64(time.Second))
+		if math.IsNaN(ns) || ns < -(1<<63) || ns >= 1<<63 {
+			return fail(ErrConversionRange)
+		}
+		return time.Duration(ns), nil
+	}
+	if n.mag > math.MaxInt64/uint64(time.Second) {
+		return fail(ErrConversionRange)
+	}
+	d := time.Duration(n.mag) * time.Second
+	if n.neg {
+		d = -d
+	}
+	return d, nil
+}
+
+//
+//
+//
+//
+//
+
+// A number as read from any input: an exact integer (sign and magnitude) or a float
+type numeric struct {
+	isFloat bool
+	neg     bool
+	mag     uint64
+	f       float64
+}
+
+func toNumeric(input interface{}) (numeric, error) {
+	switch v := reflect.ValueOf(input); v.Kind() {
+	case reflect.String:
+		return parseNumericString(v.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if i < 0 {
+			return numeric{neg: true, mag: uint64(-i)}, nil //Wraps correctly for the most negative int64
+		}
+		return numeric{mag: uint64(i)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return numeric{mag: v.Uint()}, nil
+	case reflect.Float32, reflect.Float64:
+		return numeric{isFloat: true, f: v.Float()}, nil
+	case reflect.Bool:
+		if v.Bool() {
+			return numeric{mag: 1}, nil
+		}
+		return numeric{}, nil
+	}
+	return numeric{}, ErrConversionType
+}
+
+// Parses integers (with optional sign, 0x/0b/0o prefix and underscores between digits), or failing that, floats
+func parseNumericString(s string) (numeric, error) {
+	s = strings.TrimSpace(s)
+	n := numeric{}
+	digits := s
+	if digits != "" && (digits[0] == '-' || digits[0] == '+') {
+		n.neg = digits[0] == '-'
+		digits = digits[1:]
+	}
+	base := 10
+	if len(digits) > 2 && digits[0] == '0' {
+		switch digits[1] {
+		case 'x', 'X':
+			base = 16
+		case 'b', 'B':
+			base = 2
+		case 'o', 'O':
+			base = 8
+		}
+		if base != 10 {
+			digits = digits[2:]
+		}
+	}
+	if strings.Contains(digits, "_") {
+		if strings.HasPrefix(digits, "_") || strings.HasSuffix(digits, "_") || strings.Contains(digits, "__") {
+			return n, ErrConversionSyntax
+		}
+		digits = strings.Replace(digits, "_", "", -1)
+	}
+	mag, err := strconv.ParseUint(digits, base, 64)
+	if err == nil {
+		n.mag = mag
+		return n, nil
+	}
+	if err.(*strconv.NumError).Err == strconv.ErrRange {
+		return n, ErrConversionRange
+	}
+	if base != 10 || digits == "" || digits[0] == '+' || digits[0] == '-' {
+		return n, ErrConversionSyntax
+	}
+	f, err := strconv.ParseFloat(digits, 64)
+	if err != nil {
+		if err.(*strconv.NumError).Err == strconv.ErrRange {
+			return n, ErrConversionRange
+		}
+		return n, ErrConversionSyntax
+	}
+	if n.neg {
+		f = -f
+	}
+	return numeric{isFloat: true, f: f}, nil
+}
+
+// Returns ErrConversionRange for NaN and infinities, ErrConversionLossy for fractions
+func checkIntegral(f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return ErrConversionRange
+	}
+	if f != math.Trunc(f) {
+		return ErrConversionLossy
+	}
+	return nil
+}
@@ -0,0 +1,476 @@
+package wiz
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//		Cron expressions and a scheduler that runs jobs on them.
+
+//		Expressions have 5 fields (minute hour day-of-month month day-of-week)
+//			or 6 (second first). Each field is a comma separated list of:
+//				*			every value (? is the same)
+//				5			one value
+//				1-5			a range
+//				*/15, 1-30/2, 5/10	every nth value of a range (5/10 means 5-max/10)
+//			Months and weekdays can also be names (JAN-DEC, SUN-SAT); Sunday is
+//			0 or 7. As in Vixie cron, if both day fields are restricted a day
+//			matching either one runs the job; otherwise both must match.
+//		Shortcuts: @yearly (or @annually), @monthly, @weekly, @daily (or
+//			@midnight), @hourly, and @every <duration> using ParseDuration
+//			("@every 1h30m"). @every counts from the previous run, not the clock.
+//		"CRON_TZ=Europe/London 0 9 * * *" pins an expression to a time zone.
+//			Otherwise it runs in the scheduler's Location (time.Local by default).
+
+//		Across daylight saving changes, local times that don't exist are
+//			skipped and local times that happen twice run twice, as in most crons.
+
+//		Schedules are pure: Next depends only on its argument, so next-run
+//			times can be checked in tests without running anything. The scheduler
+//			itself waits on a Clock, so a FakeClock drives it in tests.
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+//		Example:
+//		s := NewScheduler(SchedulerOptions{})
+//		err := s.Add("cleanup", "0 3 * * *", cleanup)	//03:00 every day
+//		s.Start()
+//		...
+//		err = s.Stop(ctx)	//Waits (until ctx is done) for running jobs to finish
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+// When something should run. Next returns the first run time strictly after a given time, or the zero time if there is none.
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// A job for Scheduler.AddJob. With NoOverlap set, a run is skipped if the previous one has not finished.
+type CronJob struct {
+	Name      string
+	Schedule  Schedule
+	Run       func() error
+	NoOverlap bool
+}
+
+// Settings for NewScheduler. Zero values mean the current Clock (as of NewScheduler), time.Local, and printing errors with Red.
+type SchedulerOptions struct {
+	Clock    Clock
+	Location *time.Location
+	OnError  func(job string, err error) //Called with errors returned by jobs, and panics recovered from them
+}
+
+// Runs CronJobs. Safe for concurrent use.
+type Scheduler struct {
+	lock     sync.Mutex
+	opts     SchedulerOptions
+	jobs     []*scheduledJob
+	stop     chan struct{} //Closed by Stop; nil when not started
+	wake     chan struct{} //Tells the loop the job list changed
+	loopDone chan struct{}
+	running  sync.WaitGroup
+}
+
+// Parses a cron expression (see top of Cron.go)
+func ParseCron(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	var location *time.Location
+	if strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=") {
+		space := strings.IndexAny(expr, " \t")
+		if space < 0 {
+			return nil, errors.New("wiz.ParseCron: time zone without expression")
+		}
+		name := expr[strings.IndexByte(expr, '=')+1 : space]
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, errors.Wrap(err, "wiz.ParseCron")
+		}
+		location, expr = loc, strings.TrimSpace(expr[space:])
+	}
+	if strings.HasPrefix(expr, "@every") {
+		d, err := ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every")))
+		if err != nil {
+			return nil, errors.Wrap(err, "wiz.ParseCron")
+		}
+		if d < time.Second {
+			return nil, errors.New("wiz.ParseCron: @every needs at least a second")
+		}
+		return everySchedule{d}, nil
+	}
+	if shortcut, ok := cronShortcuts[expr]; ok {
+		expr = shortcut
+	}
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, errors.New("wiz.ParseCron: expected 5 or 6 fields, got " + strconv.Itoa(len(fields)))
+	}
+	c := &cronSchedule{location: location}
+	bits := []*uint64{&c.seconds, &c.minutes, &c.hours, &c.days, &c.months, &c.weekdays}
+	for i, f := range fields {
+		b, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "wiz.ParseCron: "+cronFields[i].name)
+		}
+		*bits[i] = b
+	}
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1 //7 is Sunday too
+	}
+	c.anyDay = fields[3][0] == '*' || fields[3][0] == '?' || fields[5][0] == '*' || fields[5][0] == '?'
+	return c, nil
+}
+
+// Creates a stopped Scheduler
+func NewScheduler(opts SchedulerOptions) *Scheduler {
+	if opts.Clock == nil {
+		opts.Clock = currentClock()
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(job string, err error) {
+			Red("wiz.Scheduler:", job+":", err)
+		}
+	}
+	return &Scheduler{opts: opts, wake: make(chan struct{}, 1)}
+}
+
+// Adds a job that runs on a cron expression. Runs may overlap if the job is slow.
+func (s *Scheduler) Add(name, expr string, run func() error) error {
+	schedule, err := ParseCron(expr)
+	if err != nil {
+		return errors.Wrap(err, "wiz.Scheduler.Add")
+	}
+	return s.AddJob(CronJob{Name: name, Schedule: schedule, Run: run})
+}
+
+// Adds a job. Names must be unique.
+func (s *Scheduler) AddJob(job CronJob) error {
+	if job.Schedule == nil || job.Run == nil {
+		return errors.New("wiz.Scheduler.AddJob: job needs a Schedule and a Run function")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, j := range s.jobs {
+		if j.Name == job.Name {
+			return errors.New("wiz.Scheduler.AddJob: duplicate job name " + strconv.Quote(job.Name))
+		}
+	}
+	j := &scheduledJob{CronJob: job}
+	j.next = job.Schedule.Next(s.now())
+	s.jobs = append(s.jobs, j)
+	s.poke()
+	return nil
+}
+
+// Removes a job by name. Runs already in progress are not interrupted.
+func (s *Scheduler) Remove(name string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, j := range s.jobs {
+		if j.Name == name {
+			s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+			s.poke()
+			return true
+		}
+	}
+	return false
+}
+
+// Returns when a job will next run (zero time if never, false if there is no such job)
+func (s *Scheduler) NextRun(name string) (time.Time, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, j := range s.jobs {
+		if j.Name == name {
+			return j.next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Starts running jobs in the background. Does nothing if already started.
+func (s *Scheduler) Start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stop != nil {
+		return
+	}
+	select {
+	case <-s.wake: //The loop reads the job list when it starts anyway
+	default:
+	}
+	s.stop = make(chan struct{})
+	s.loopDone = make(chan struct{})
+	go s.loop(s.stop, s.loopDone)
+}
+
+// Stops starting new runs, then waits for running jobs to finish or ctx to be done (returning ctx.Err()). The scheduler can be started again.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.lock.Lock()
+	stop, loopDone := s.stop, s.loopDone
+	s.stop = nil
+	s.lock.Unlock()
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	<-loopDone
+	finished := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "wiz.Scheduler.Stop")
+	}
+}
+
+//
+//
+//
+//
+//
+
+type scheduledJob struct {
+	CronJob
+	next    time.Time
+	running int //Runs in progress, guarded by the scheduler lock
+}
+
+// Caller holds lock
+func (s *Scheduler) now() time.Time {
+	return s.opts.Clock.Now().In(s.opts.Location)
+}
+
+// Caller holds lock
+func (s *Scheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) loop(stop, done chan struct{}) {
+	defer close(done)
+	for {
+		s.lock.Lock()
+		now := s.now()
+		var earliest time.Time
+		for _, j := range s.jobs {
+			if j.next.IsZero() {
+				continue
+			}
+			if !j.next.After(now) {
+				s.launch(j)
+				j.next = j.Schedule.Next(now)
+				if j.next.IsZero() {
+					continue
+				}
+			}
+			if earliest.IsZero() || j.next.Before(earliest) {
+				earliest = j.next
+			}
+		}
+		s.lock.Unlock()
+
+		var timer Timer
+		var fire <-chan time.Time
+		if !earliest.IsZero() {
+			timer = s.opts.Clock.NewTimer(earliest.Sub(now))
+			fire = timer.C()
+		}
+		select {
+		case <-fire:
+		case <-s.wake:
+		case <-stop:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		select {
+		case <-stop:
+			return
+		default:
+		}
+	}
+}
+
+// Caller holds lock
+func (s *Scheduler) launch(j *scheduledJob) {
+	if j.NoOverlap && j.running > 0 {
+		return
+	}
+	j.running++
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		err := runCronJob(j.Name, j.Run)
+		s.lock.Lock()
+		j.running--
+		s.lock.Unlock()
+		if err != nil {
+			s.opts.OnError(j.Name, err)
+		}
+	}()
+}
+
+func runCronJob(name string, run func() error) (e error) {
+	defer Antipanic(&e, "wiz.Scheduler: "+name)
+	return run()
+}
+
+type everySchedule struct {
+	every time.Duration
+}
+
+func (e everySchedule) Next(after time.Time) time.Time {
+	return after.Add(e.every)
+}
+
+// Bit i of each field is set if value i matches
+type cronSchedule struct {
+	seconds, minutes, hours, days, months, weekdays uint64
+	anyDay                                          bool //Either day field is unrestricted, so both must match
+	location                                        *time.Location
+}
+
+func (c *cronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	if c.location != nil {
+		loc = c.location
+	}
+	t := after.In(loc)
+	t = t.Add(time.Second - time.Duration(t.Nanosecond())) //Next whole second
+	//Each step moves forward in absolute time, so DST changes can't cause loops
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		if c.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hours&(1<<uint(t.Hour())) == 0 {
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second)
+			continue
+		}
+		if c.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute - time.Duration(t.Second())*time.Second)
+			continue
+		}
+		if c.seconds&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	day := c.days&(1<<uint(t.Day())) != 0
+	weekday := c.weekdays&(1<<uint(t.Weekday())) != 0
+	if c.anyDay {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+type cronField struct {
+	name    string
+	min     int
+	max     int
+	aliases map[string]int
+}
+
+var cronFields = []cronField{
+	{"second", 0, 59, nil},
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, map[string]int{"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12}},
+	{"day of week", 0, 7, map[string]int{"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6}},
+}
+
+var cronShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func parseCronField(field string, f cronField) (uint64, error) {
+	value := func(s string) (int, error) {
+		if n, ok := f.aliases[strings.ToUpper(s)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < f.min || n > f.max {
+			return 0, errors.New(strconv.Quote(s) + " is not between " + strconv.Itoa(f.min) + " and " + strconv.Itoa(f.max))
+		}
+		return n, nil
+	}
+	bits := uint64(0)
+	for _, part := range strings.Split(field, ",") {
+		step := 0
+		if slash := strings.IndexByte(part, '/'); slash >= 0 {
+			n, err := strconv.Atoi(part[slash+1:])
+			if err != nil || n <= 0 {
+				return 0, errors.New("invalid step in " + strconv.Quote(part))
+			}
+			step, part = n, part[:slash]
+		}
+		var start, end int
+		var err error
+		switch dash := strings.IndexByte(part, '-'); {
+		case part == "*" || part == "?":
+			start, end = f.min, f.max
+		case dash >= 0:
+			if start, err = value(part[:dash]); err != nil {
+				return 0, err
+			}
+			if end, err = value(part[dash+1:]); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, errors.New("backwards range " + strconv.Quote(part))
+			}
+		default:
+			if start, err = value(part); err != nil {
+				return 0, err
+			}
+			end = start
+			if step > 0 {
+				end = f.max
+			}
+		}
+		if step == 0 {
+			step = 1
+		}
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
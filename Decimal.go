@@ -0,0 +1,323 @@
+package wiz
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//		Exact decimal numbers, for money and anything else that must not pick
+//			up binary floating point errors (0.1 + 0.2 is exactly 0.3 here).
+
+//		A Decimal is an integer of any size plus a scale: the number of digits
+//			after the decimal point. 123.45 is 12345 with scale 2. Decimals are
+//			values: methods return new Decimals and never change the receiver.
+//			The zero value is 0.
+
+//		Add, Sub and Mul are always exact (results have as many decimal places
+//			as they need). Div and Round take a scale and a RoundingMode, since
+//			their results usually don't fit exactly:
+//				price.Mul(rate).Round(2, RoundHalfEven)
+//				total.Div(NewDecimal(3, 0), 2, RoundDown)
+
+//		Scale is fixed per value rather than for the whole package: a Decimal
+//			keeps the scale it was made with, and only Round and Div (which are
+//			told the scale to use) produce a different one. A single package
+//			scale would mean Mul silently rounding every product with some
+//			mode nobody chose; instead, code holding money at 2 places calls
+//			Round(2, mode) after Mul, so the rounding is always visible.
+
+//		JSON is a string ("123.45"), so no precision is lost in JavaScript or
+//			other parsers that read numbers as floats. Unmarshalling accepts
+//			strings and numbers. Text marshalling is the same string, so
+//			Decimals work with Bind and as map keys.
+
+//		DecimalFrom converts anything Uint64 accepts. Floats use the shortest
+//			decimal that reads back as the same float, so 0.1 gives 0.1 rather
+//			than 0.1000000000000000055511151231257827...
+
+// Arbitrary precision decimal number
+type Decimal struct {
+	value *big.Int //Nil means zero
+	scale uint
+}
+
+// How to round a result that doesn't fit in the requested scale
+type RoundingMode int
+
+const (
+	RoundHalfEven RoundingMode = iota //To nearest, ties to even (banker's rounding)
+	RoundHalfUp                       //To nearest, ties away from zero
+	RoundHalfDown                     //To nearest, ties towards zero
+	RoundDown                         //Towards zero (truncate)
+	RoundUp                           //Away from zero
+	RoundFloor                        //Towards negative infinity
+	RoundCeiling                      //Towards positive infinity
+)
+
+// Returns unscaled / 10^scale, e.g. NewDecimal(12345, 2) is 123.45
+func NewDecimal(unscaled int64, scale uint) Decimal {
+	return Decimal{big.NewInt(unscaled), scale}
+}
+
+// Parses a decimal such as "-123.45", "0.5", "7" or "1.5e3". The scale is the number of digits after the point, so "1.50" has scale 2.
+func ParseDecimal(s string) (Decimal, error) {
+	fail := func() (Decimal, error) { return Decimal{}, &ConversionError{"ParseDecimal", s, ErrConversionSyntax} }
+	text := strings.TrimSpace(s)
+	exponent := int64(0)
+	if e := strings.IndexAny(text, "eE"); e >= 0 {
+		n, err := strconv.ParseInt(text[e+1:], 10, 32)
+		if err != nil || n > maxDecimalExponent || n < -maxDecimalExponent {
+			return fail()
+		}
+		text, exponent = text[:e], n
+	}
+	sign := ""
+	if text != "" && (text[0] == '-' || text[0] == '+') {
+		sign, text = text[:1], text[1:]
+	}
+	whole, fraction := text, ""
+	if dot := strings.IndexByte(text, '.'); dot >= 0 {
+		whole, fraction = text[:dot], text[dot+1:]
+	}
+	digits := whole + fraction
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return fail()
+	}
+	value, _ := new(big.Int).SetString(sign+digits, 10)
+	scale := int64(len(fraction)) - exponent
+	if scale < 0 {
+		value.Mul(value, pow10(uint(-scale)))
+		scale = 0
+	}
+	return Decimal{value, uint(scale)}, nil
+}
+
+// Converts a Decimal, or anything Uint64 accepts (see top of Convert.go), to a Decimal
+func DecimalFrom(input interface{}) (Decimal, error) {
+	fail := func(err error) (Decimal, error) { return Decimal{}, &ConversionError{"DecimalFrom", input, err} }
+	switch v := input.(type) {
+	case Decimal:
+		return v, nil
+	case *big.Int:
+		return Decimal{new(big.Int).Set(v), 0}, nil
+	}
+	if v := reflect.ValueOf(input); v.Kind() == reflect.String {
+		if d, err := ParseDecimal(v.String()); err == nil {
+			return d, nil
+		}
+	}
+	n, err := toNumeric(input)
+	if err != nil {
+		return fail(err)
+	}
+	if n.isFloat {
+		if checkIntegral(n.f) == ErrConversionRange {
+			return fail(ErrConversionRange)
+		}
+		return ParseDecimal(strconv.FormatFloat(n.f, 'g', -1, 64))
+	}
+	value := new(big.Int).SetUint64(n.mag)
+	if n.neg {
+		value.Neg(value)
+	}
+	return Decimal{value, 0}, nil
+}
+
+// Returns d + e
+func (d Decimal) Add(e Decimal) Decimal {
+	a, b, scale := align(d, e)
+	return Decimal{a.Add(a, b), scale}
+}
+
+// Returns d - e
+func (d Decimal) Sub(e Decimal) Decimal {
+	a, b, scale := align(d, e)
+	return Decimal{a.Sub(a, b), scale}
+}
+
+// Returns d * e, exactly (the scale is the sum of both scales)
+func (d Decimal) Mul(e Decimal) Decimal {
+	return Decimal{new(big.Int).Mul(d.int(), e.int()), d.scale + e.scale}
+}
+
+// Returns d / e rounded to a given scale
+func (d Decimal) Div(e Decimal, scale uint, mode RoundingMode) (Decimal, error) {
+	if e.Sign() == 0 {
+		return Decimal{}, errors.New("wiz.Decimal.Div: division by zero")
+	}
+	//d/e = (dv/10^ds) / (ev/10^es); multiply by 10^scale to get the unscaled result
+	num, den := new(big.Int).Set(d.int()), new(big.Int).Set(e.int())
+	if shift := int64(scale) + int64(e.scale) - int64(d.scale); shift >= 0 {
+		num.Mul(num, pow10(uint(shift)))
+	} else {
+		den.Mul(den, pow10(uint(-shift)))
+	}
+	return Decimal{roundQuotient(num, den, mode), scale}, nil
+}
+
+// Returns d with a given scale, rounding if that means fewer decimal places
+func (d Decimal) Round(scale uint, mode RoundingMode) Decimal {
+	if scale >= d.scale {
+		return Decimal{new(big.Int).Mul(d.int(), pow10(scale-d.scale)), scale}
+	}
+	return Decimal{roundQuotient(d.int(), pow10(d.scale-scale), mode), scale}
+}
+
+// Returns -d
+func (d Decimal) Neg() Decimal {
+	return Decimal{new(big.Int).Neg(d.int()), d.scale}
+}
+
+// Returns |d|
+func (d Decimal) Abs() Decimal {
+	return Decimal{new(big.Int).Abs(d.int()), d.scale}
+}
+
+// Returns -1, 0 or +1 as d is less than, equal to or greater than e (scales don't matter: 1.50 equals 1.5)
+func (d Decimal) Cmp(e Decimal) int {
+	a, b, _ := align(d, e)
+	return a.Cmp(b)
+}
+
+// Returns -1, 0 or +1 as d is negative, zero or positive
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+// Returns the number of digits after the decimal point
+func (d Decimal) Scale() uint {
+	return d.scale
+}
+
+// Returns the integer that d is a scaled version of (a copy), e.g. 12345 for 123.45
+func (d Decimal) Unscaled() *big.Int {
+	return new(big.Int).Set(d.int())
+}
+
+// Returns the nearest float64, for display or maths where exactness doesn't matter
+func (d Decimal) Float64() float64 {
+	f, _ := new(big.Rat).SetFrac(d.int(), pow10(d.scale)).Float64()
+	return f
+}
+
+// Returns d with exactly Scale() decimal places, e.g. "-123.45" or "0.050"
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.int()).String()
+	if len(digits) <= int(d.scale) {
+		digits = strings.Repeat("0", int(d.scale)-len(digits)+1) + digits
+	}
+	if d.scale > 0 {
+		point := len(digits) - int(d.scale)
+		digits = digits[:point] + "." + digits[point:]
+	}
+	if d.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Encodes d as a JSON string, e.g. "123.45"
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// Decodes a JSON string or number. null leaves d unchanged, as with other encoding/json types.
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if string(b) == "null" {
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		s := ""
+		if err := json.Unmarshal(b, &s); err != nil {
+			return errors.Wrap(err, "wiz.Decimal.UnmarshalJSON")
+		}
+		b = []byte(s)
+	}
+	return d.UnmarshalText(b)
+}
+
+// Encodes d as its String form
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Parses d using ParseDecimal
+func (d *Decimal) UnmarshalText(b []byte) error {
+	parsed, err := ParseDecimal(string(b))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+//
+//
+//
+//
+//
+
+// Limits exponents in ParseDecimal, so "1e999999999" can't use up all memory
+const maxDecimalExponent = 10000
+
+func (d Decimal) int() *big.Int {
+	if d.value == nil {
+		return new(big.Int)
+	}
+	return d.value
+}
+
+func pow10(n uint) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// Returns new unscaled values of d and e at the larger of their scales
+func align(d, e Decimal) (*big.Int, *big.Int, uint) {
+	a, b := new(big.Int).Set(d.int()), new(big.Int).Set(e.int())
+	switch {
+	case d.scale < e.scale:
+		a.Mul(a, pow10(e.scale-d.scale))
+		return a, b, e.scale
+	case e.scale < d.scale:
+		b.Mul(b, pow10(d.scale-e.scale))
+	}
+	return a, b, d.scale
+}
+
+// Returns num/den rounded to an integer
+func roundQuotient(num, den *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int)) //Truncates towards zero
+	if r.Sign() == 0 {
+		return q
+	}
+	sign := int64(num.Sign() * den.Sign())
+	//Compare the remainder with half the divisor
+	half := new(big.Int).Abs(r)
+	half.Mul(half, big.NewInt(2))
+	vsHalf := half.Cmp(new(big.Int).Abs(den))
+	away := false
+	switch mode {
+	case RoundUp:
+		away = true
+	case RoundCeiling:
+		away = sign > 0
+	case RoundFloor:
+		away = sign < 0
+	case RoundHalfUp:
+		away = vsHalf >= 0
+	case RoundHalfDown:
+		away = vsHalf > 0
+	case RoundHalfEven:
+		away = vsHalf > 0 || vsHalf == 0 && q.Bit(0) == 1
+	}
+	if away {
+		q.Add(q, big.NewInt(sign))
+	}
+	return q
+}
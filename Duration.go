@@ -0,0 +1,194 @@
+package wiz
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//		Human readable durations.
+
+//		ParseDuration accepts everything time.ParseDuration does ("1h30m",
+//			"-1.5s", "300ms"), plus d for days and w for weeks: "1d12h", "2w",
+//			"1.5d". A day is always 24 hours and a week 7 days, regardless of
+//			daylight saving.
+
+//		FormatDuration writes the largest units first and keeps at most
+//			precision of them, truncating the rest:
+//			FormatDuration(3*time.Hour+12*time.Minute+5*time.Second, 2) = "3h12m"
+//			FormatDuration(36*time.Hour, 0) = "1d12h"	(0 keeps every unit)
+
+//		Ago and Until measure against the current Clock and keep two units,
+//			which reads well next to the Console printers:
+//			Yellow("Last backup", Ago(UnixToTime(snapshot.Time)))	//Last backup 3h12m ago
+
+// Parses a duration such as "1d12h" or "90m" (see top of Duration.go)
+func ParseDuration(s string) (time.Duration, error) {
+	orig := s
+	fail := func(reason string) (time.Duration, error) {
+		return 0, errors.New("wiz.ParseDuration: " + reason + " in " + strconv.Quote(orig))
+	}
+	negative := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+	if s == "0" {
+		return 0, nil
+	}
+	if s == "" {
+		return fail("missing value")
+	}
+	var total uint64
+	for s != "" {
+		//Whole part
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		whole, rest := s[:i], s[i:]
+		//Fractional part
+		fraction := ""
+		if rest != "" && rest[0] == '.' {
+			j := 1
+			for j < len(rest) && rest[j] >= '0' && rest[j] <= '9' {
+				j++
+			}
+			fraction, rest = rest[1:j], rest[j:]
+		}
+		if whole == "" && fraction == "" {
+			return fail("missing number")
+		}
+		//Unit
+		j := 0
+		for j < len(rest) && rest[j] != '.' && (rest[j] < '0' || rest[j] > '9') {
+			j++
+		}
+		unit, ok := durationUnits[rest[:j]]
+		if !ok {
+			if j == 0 {
+				return fail("missing unit")
+			}
+			return fail("unknown unit " + strconv.Quote(rest[:j]))
+		}
+		s = rest[j:]
+
+		n := uint64(0)
+		if whole != "" {
+			var err error
+			n, err = strconv.ParseUint(whole, 10, 64)
+			if err != nil || n > durationLimit/unit {
+				return fail("overflow")
+			}
+		}
+		n *= unit
+		//Add the fraction of a unit, one digit at a time, ignoring digits too small to matter
+		scale := unit
+		for k := 0; k < len(fraction) && scale >= 10; k++ {
+			scale /= 10
+			n += uint64(fraction[k]-'0') * scale
+		}
+		if n > durationLimit-total {
+			return fail("overflow")
+		}
+		total += n
+	}
+	if negative {
+		return -time.Duration(total), nil
+	}
+	return time.Duration(total), nil
+}
+
+// Formats a duration using w, d, h, m, s (and ms, us, ns below a second), keeping at most precision units (0 for all)
+func FormatDuration(d time.Duration, precision int) string {
+	if d == 0 {
+		return "0s"
+	}
+	sb := strings.Builder{}
+	n := uint64(d)
+	if d < 0 {
+		sb.WriteString("-")
+		n = uint64(-d) //Also correct for the most negative duration, as uint64 wraps
+	}
+	used := 0
+	for _, u := range durationFormatUnits {
+		if precision > 0 && used == precision {
+			break
+		}
+		if n >= u.size {
+			sb.WriteString(strconv.FormatUint(n/u.size, 10) + u.name)
+			n %= u.size
+			used++
+		} else if used > 0 {
+			used++ //Skipped units count, so 1d0h5m at precision 2 is "1d", not "1d5m"
+		}
+	}
+	return sb.String()
+}
+
+// Describes how long ago t was, e.g. "3h12m ago", or "in 3h12m" if t is in the future
+func Ago(t time.Time) string {
+	return AgoOn(currentClock(), t)
+}
+
+// Ago, according to a given Clock
+func AgoOn(c Clock, t time.Time) string {
+	d := c.Now().Sub(t).Truncate(time.Second)
+	switch {
+	case d == 0:
+		return "just now"
+	case d < 0:
+		return "in " + FormatDuration(-d, 2)
+	}
+	return FormatDuration(d, 2) + " ago"
+}
+
+// Describes how long is left until t, e.g. "3h12m", or "0s" if t has passed
+func Until(t time.Time) string {
+	return UntilOn(currentClock(), t)
+}
+
+// Until, according to a given Clock
+func UntilOn(c Clock, t time.Time) string {
+	d := t.Sub(c.Now()).Truncate(time.Second)
+	if d <= 0 {
+		return "0s"
+	}
+	return FormatDuration(d, 2)
+}
+
+//
+//
+//
+//
+//
+
+const durationLimit = 1<<63 - 1
+
+var durationUnits = map[string]uint64{
+	"ns": uint64(time.Nanosecond),
+	"us": uint64(time.Microsecond),
+	"µs": uint64(time.Microsecond), //U+00B5
+	"μs": uint64(time.Microsecond), //U+03BC
+	"ms": uint64(time.Millisecond),
+	"s":  uint64(time.Second),
+	"m":  uint64(time.Minute),
+	"h":  uint64(time.Hour),
+	"d":  uint64(24 * time.Hour),
+	"w":  uint64(7 * 24 * time.Hour),
+}
+
+var durationFormatUnits = []struct {
+	name string
+	size uint64
+}{
+	{"w", uint64(7 * 24 * time.Hour)},
+	{"d", uint64(24 * time.Hour)},
+	{"h", uint64(time.Hour)},
+	{"m", uint64(time.Minute)},
+	{"s", uint64(time.Second)},
+	{"ms", uint64(time.Millisecond)},
+	{"us", uint64(time.Microsecond)},
+	{"ns", uint64(time.Nanosecond)},
+}
@@ -2,6 +2,7 @@ package wiz
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/pkg/errors"
 	"io/ioutil"
@@ -44,7 +45,8 @@ import (
 
 // Wrapper for http client with additional methods
 type Client struct {
-	client *http.Client
+	client  *http.Client
+	limiter Limiter
 }
 
 // Creates a new Client from an http.Client, with a request timeout in seconds.
@@ -61,11 +63,19 @@ func NewClient(c *http.Client, timeout int) Client {
 	return Client{client: c}
 }
 
+// Makes every request wait for a limiter first (nil removes it). See RateLimit.go.
+func (c *Client) SetLimiter(l Limiter) {
+	c.limiter = l
+}
+
 // Classic HTTP Get, returning response body (error if status code outside 200-299 range)
 func (c *Client) Get(url string) ([]byte, error) {
 	if c == nil || c.client == nil {
 		return []byte{}, errors.New("wiz.Client.Get: nil client")
 	}
+	if err := c.wait(); err != nil {
+		return []byte{}, errors.Wrap(err, "wiz.Client.Get")
+	}
 	r, err := c.client.Get(url)
 	if err != nil {
 		return []byte{}, errors.Wrap(err, "wiz.Client.Get")
@@ -114,6 +124,9 @@ func (c *Client) Post(url string, requestBody []byte) ([]byte, error) {
 	if c == nil || c.client == nil {
 		return []byte{}, errors.New("wiz.Client.Post: nil client")
 	}
+	if err := c.wait(); err != nil {
+		return []byte{}, errors.Wrap(err, "wiz.Client.Post")
+	}
 	r, err := c.client.Post(url, "application/json", bytes.NewBuffer(requestBody))
 	if err != nil {
 		return []byte{}, errors.Wrap(err, "wiz.Client.Post")
@@ -167,6 +180,16 @@ func (c *Client) PostStruct(url string, requestStruct interface{}, responseStruc
 //
 //
 
+// Waits for the limiter, if there is one. Bounded by the client timeout.
+func (c *Client) wait() error {
+	if c.limiter == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.client.Timeout)
+	defer cancel()
+	return c.limiter.Wait(ctx)
+}
+
 // Splits a url at '/' characters
 func SplitURL(url string) []string {
 	u := strings.Split(url, "/")
@@ -185,7 +208,29 @@ func SplitURL(url string) []string {
 
 //Serve on a given address, and forward GET and POST requests to the separate handlers provided
 func ServeSimple(ln net.Listener, getter func([]string) (int, []byte), poster func([]string, []byte) (int, []byte)) error {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return http.Serve(ln, simpleHandler(getter, poster))
+}
+
+// ServeSimple, but each client IP address is limited by its own limiter from a KeyedLimiter. Requests over the limit get status 429.
+func ServeLimited(ln net.Listener, limiter *KeyedLimiter, getter func([]string) (int, []byte), poster func([]string, []byte) (int, []byte)) error {
+	handler := simpleHandler(getter, poster)
+	return http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if !limiter.Allow(host) {
+			w.WriteHeader(429) //Too many requests
+			w.Write([]byte("wiz.ServeLimited: Too many requests"))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+// Forwards GET and POST requests to the separate handlers provided
+func simpleHandler(getter func([]string) (int, []byte), poster func([]string, []byte) (int, []byte)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		//Begin root handler function
 		url := SplitURL(r.URL.Path)
 		method := r.Method
@@ -209,5 +254,4 @@ func ServeSimple(ln net.Listener, getter func([]string) (int, []byte), poster fu
 		w.Write(response)
 		//End root handler function
 	})
-	return http.Serve(ln, http.HandlerFunc(handler))
 }
@@ -1,6 +1,9 @@
 package wiz
 
-import sha3 "golang.org/x/crypto/sha3"
+import (
+	"crypto/subtle"
+	sha3 "golang.org/x/crypto/sha3"
+)
 
 //		SHA3-512
 
@@ -18,10 +21,6 @@ func HashMatch(data []byte, hash []byte) bool {
 	if len(hash) != 64 {
 		return false
 	}
-	a := [64]byte{}
-	b := [64]byte{}
-	copy(a[:], Hash(data))
-	copy(b[:], hash)
-	//Arrays can be compared directly using ==.
-	return (a == b)
+	//Constant time comparison, so timing does not reveal how much of the hash matched
+	return subtle.ConstantTimeCompare(Hash(data), hash) == 1
 }
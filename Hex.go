@@ -3,6 +3,7 @@ package wiz
 import (
 	"encoding/hex"
 	"github.com/pkg/errors"
+	"strconv"
 	"strings"
 )
 
@@ -12,8 +13,17 @@ func BytesToHex(data []byte) string {
 	return strings.ToUpper(str)
 }
 
-// HexToBytes Converts string to byte slice if it is valid hexadecimal. Slice length is zero on fail.
+// HexToBytes Converts string to byte slice if it is valid hexadecimal (either case). Slice length is zero on fail. Invalid input gives a *DecodeError (see errors.Cause).
 func HexToBytes(data string) ([]byte, error) {
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+			return []byte{}, errors.Wrap(&DecodeError{"hex", i, "invalid character " + strconv.QuoteRune(rune(c))}, "wiz.HexToBytes")
+		}
+	}
+	if len(data)%2 != 0 {
+		return []byte{}, errors.Wrap(&DecodeError{"hex", len(data), "odd length"}, "wiz.HexToBytes")
+	}
 	b, err := hex.DecodeString(data)
 	if err != nil {
 		return []byte{}, errors.Wrap(err, "wiz.HexToBytes")
@@ -0,0 +1,303 @@
+package wiz
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//		Hex dumps, in the style of xxd, and parsing them back into bytes.
+
+//		Default output (16 bytes per line, groups of 2, offsets, ASCII gutter):
+//			00000000: 4865 6C6C 6F2C 2077 6F72 6C64 210A 0001  Hello, world!...
+//			00000010: 0203                                     ..
+//		The gutter shows bytes that Printable accepts, and '.' for the rest.
+
+//		With Color set, offsets are blue, printable bytes green and the rest
+//			yellow (in both the hex and the gutter). Colour is applied even when
+//			output is not a terminal, since it was asked for explicitly.
+
+//		ParseHexDump accepts:
+//			- Dumps made by HexDump (with or without colour), xxd, and hexdump -C
+//			- Plain hex in any case, with any whitespace: "48 65 6c", "48656C"
+//			- 0x prefixes and commas: "0x48, 0x65, 0x6C"
+//		An ASCII gutter is found by its layout: two or more spaces after the
+//			hex, then one character per byte, each either the byte itself or '.'
+//			(as HexDump and xxd write it). Anything else after a double space is
+//			read as hex. Lines containing '|' have a hexdump -C style gutter.
+//		A '*' line (hexdump -C, xxd -a) repeats the line before it up to the
+//			next offset. The bare offset hexdump -C writes last ends the dump.
+
+// Layout options for HexDumpWith. Width is bytes per line; Group is bytes per space-separated group.
+type HexDumpOptions struct {
+	Width   int
+	Group   int
+	Offsets bool
+	ASCII   bool
+	Color   bool
+}
+
+// Options used by HexDump
+var DefaultHexDumpOptions = HexDumpOptions{Width: 16, Group: 2, Offsets: true, ASCII: true}
+
+// Returns an xxd style dump of data using DefaultHexDumpOptions
+func HexDump(data []byte) string {
+	return HexDumpWith(data, DefaultHexDumpOptions)
+}
+
+// Returns a hex dump of data with a given layout. Width and Group default to 16 and 2 when not positive.
+func HexDumpWith(data []byte, opts HexDumpOptions) string {
+	if opts.Width <= 0 {
+		opts.Width = 16
+	}
+	if opts.Group <= 0 {
+		opts.Group = 2
+	}
+	plain := func(s string) string { return s }
+	offsetColor, goodColor, badColor := plain, plain, plain
+	if opts.Color {
+		offsetColor, goodColor, badColor = blueString, greenString, yellowString
+	}
+	byteColor := func(b byte) func(string) string {
+		if printableByte(b) {
+			return goodColor
+		}
+		return badColor
+	}
+	//Width of a full line of hex, so short final lines can be padded
+	groups := (opts.Width + opts.Group - 1) / opts.Group
+	hexWidth := opts.Width*2 + groups - 1
+
+	sb := strings.Builder{}
+	for start := 0; start < len(data); start += opts.Width {
+		end := start + opts.Width
+		if end > len(data) {
+			end = len(data)
+		}
+		line := data[start:end]
+		if opts.Offsets {
+			sb.WriteString(offsetColor(fmt.Sprintf("%08X:", start)))
+			sb.WriteString(" ")
+		}
+		written := 0
+		for i, b := range line {
+			if i > 0 && i%opts.Group == 0 {
+				sb.WriteString(" ")
+				written++
+			}
+			sb.WriteString(byteColor(b)(fmt.Sprintf("%02X", b)))
+			written += 2
+		}
+		if opts.ASCII {
+			sb.WriteString(strings.Repeat(" ", hexWidth-written+2))
+			for _, b := range line {
+				c := "."
+				if printableByte(b) {
+					c = string(b)
+				}
+				sb.WriteString(byteColor(b)(c))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Parses a hex dump (see top of HexDump.go for accepted formats) back into bytes. Errors wrap a *DecodeError (see errors.Cause), with offsets into the dump (after removing any colour codes).
+func ParseHexDump(dump string) ([]byte, error) {
+	b, err := parseHexDump(dump)
+	return b, errors.Wrap(err, "wiz.ParseHexDump")
+}
+
+//
+//
+//
+//
+//
+
+// ParseHexDump, with unprefixed errors
+func parseHexDump(dump string) ([]byte, error) {
+	dump = ansiEscape.ReplaceAllString(dump, "")
+	out := []byte{}
+	base := 0
+	canonical := false //Seen a hexdump -C line, so a bare offset ends the dump
+	//The last line's bytes and offset, and where a pending '*' line is in the dump
+	last, lastOffset, repeat := []byte{}, -1, -1
+	for _, line := range strings.SplitAfter(dump, "\n") {
+		lineBase := base
+		base += len(line)
+		start, end := 0, len(line)
+		first, firstEnd := nextHexToken(line, 0, end)
+		alone := nextHexTokenEmpty(line, firstEnd, end)
+		if line[first:firstEnd] == "*" && alone {
+			repeat = lineBase + first
+			continue
+		}
+		offset, final := "", false
+		//Skip an offset: "00000010:" or "0x10:"
+		if strings.HasSuffix(line[first:firstEnd], ":") {
+			offset = line[first : firstEnd-1]
+			start = firstEnd
+		}
+		if gutter := hexDumpGutter(line, start); gutter >= 0 {
+			end = gutter
+		} else if pipe := strings.IndexByte(line, '|'); pipe >= 0 {
+			//hexdump -C: "00000010  48 65 ...  |He...|"
+			end = pipe
+			if firstEnd-first >= 6 && start == 0 {
+				offset = line[first:firstEnd]
+				start = firstEnd
+				canonical = true
+			}
+		} else if canonical && alone && firstEnd-first >= 6 {
+			//hexdump -C ends with the offset just past the last byte
+			offset = line[first:firstEnd]
+			final = true
+		}
+		if repeat >= 0 && (offset != "" || final) {
+			var err error
+			out, err = repeatHexDumpLine(out, last, lastOffset, offset)
+			if err != nil {
+				return []byte{}, &DecodeError{"hexdump", repeat, err.Error()}
+			}
+			repeat = -1
+		}
+		if final {
+			break
+		}
+		b, err := parseHexTokens(line, start, end)
+		if err != nil {
+			err.(*DecodeError).Offset += lineBase
+			return []byte{}, err
+		}
+		out = append(out, b...)
+		if len(b) > 0 {
+			last, lastOffset = b, parseHexDumpOffset(offset)
+		}
+	}
+	if repeat >= 0 {
+		return []byte{}, &DecodeError{"hexdump", repeat, "'*' is not followed by an offset"}
+	}
+	return out, nil
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// Finds the next token in s[from:to], where tokens are separated by whitespace
+// and commas. Returns start and end indices (equal if there is none).
+func nextHexToken(s string, from, to int) (int, int) {
+	separator := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ','
+	}
+	for from < to && separator(s[from]) {
+		from++
+	}
+	end := from
+	for end < to && !separator(s[end]) {
+		end++
+	}
+	return from, end
+}
+
+// True if s[from:to] holds no more tokens
+func nextHexTokenEmpty(s string, from, to int) bool {
+	t, tEnd := nextHexToken(s, from, to)
+	return t == tEnd
+}
+
+// Parses "00000010" or "0x10" as a number, or returns -1
+func parseHexDumpOffset(offset string) int {
+	if len(offset) >= 2 && (offset[0:2] == "0x" || offset[0:2] == "0X") {
+		offset = offset[2:]
+	}
+	n, err := strconv.ParseUint(offset, 16, 31)
+	if err != nil {
+		return -1
+	}
+	return int(n)
+}
+
+// Expands a '*' line: appends copies of last, which was at lastOffset, until next (the following line's offset)
+func repeatHexDumpLine(out, last []byte, lastOffset int, next string) ([]byte, error) {
+	nextOffset := parseHexDumpOffset(next)
+	if lastOffset < 0 || nextOffset < 0 {
+		return out, errors.New("'*' needs offsets before and after it")
+	}
+	gap := nextOffset - lastOffset - len(last)
+	if gap < 0 || gap%len(last) != 0 {
+		return out, errors.New("'*' is followed by an offset that does not repeat the line before it")
+	}
+	for ; gap > 0; gap -= len(last) {
+		out = append(out, last...)
+	}
+	return out, nil
+}
+
+// Returns where the hex ends in line[start:], before an ASCII gutter, or -1 if there is no gutter
+func hexDumpGutter(line string, start int) int {
+	lineEnd := len(strings.TrimRight(line, "\r\n"))
+	//digits[i] is the number of hex digits in line[start:start+i], so unlikely gaps are skipped cheaply
+	digits := make([]int, lineEnd-start+1)
+	for i := start; i < lineEnd; i++ {
+		digits[i-start+1] = digits[i-start]
+		if c := line[i]; c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F' {
+			digits[i-start+1]++
+		}
+	}
+	for gap := start; gap+2 <= lineEnd; gap++ {
+		if line[gap] != ' ' || line[gap+1] != ' ' || gap > start && line[gap-1] == ' ' {
+			continue
+		}
+		//The gutter may itself start with spaces, so try each position after the gap
+		for g := gap + 2; g <= lineEnd && (g == gap+2 || line[g-1] == ' '); g++ {
+			if digits[gap-start] != 2*(lineEnd-g) || g == lineEnd {
+				continue
+			}
+			if b, err := parseHexTokens(line, start, gap); err == nil && gutterMatches(b, line[g:lineEnd]) {
+				return gap
+			}
+		}
+	}
+	return -1
+}
+
+// True if gutter is exactly how HexDump would show b
+func gutterMatches(b []byte, gutter string) bool {
+	if len(gutter) != len(b) {
+		return false
+	}
+	for i, c := range b {
+		if printableByte(c) && gutter[i] != c || !printableByte(c) && gutter[i] != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// Reads hex tokens ("48", "4865", "0x48", separated by whitespace or commas) from line[from:to]. Error offsets are into line.
+func parseHexTokens(line string, from, to int) ([]byte, error) {
+	out := []byte{}
+	for pos := from; ; {
+		t, tEnd := nextHexToken(line, pos, to)
+		if t == tEnd {
+			return out, nil
+		}
+		pos = tEnd
+		if tEnd-t >= 2 && (line[t:t+2] == "0x" || line[t:t+2] == "0X") {
+			t += 2
+		}
+		for i := t; i < tEnd; i++ {
+			c := line[i]
+			if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+				return []byte{}, &DecodeError{"hexdump", i, "invalid character " + strconv.QuoteRune(rune(c))}
+			}
+		}
+		if (tEnd-t)%2 != 0 || t == tEnd {
+			return []byte{}, &DecodeError{"hexdump", t, "odd number of hex digits"}
+		}
+		b, _ := HexToBytes(line[t:tEnd])
+		out = append(out, b...)
+	}
+}
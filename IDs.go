@@ -0,0 +1,348 @@
+package wiz
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//		Unique ID generation: UUIDv4, UUIDv7, ULID and Snowflake.
+
+//		UUIDv4 is 122 random bits. Use it when IDs must not reveal anything.
+//		UUIDv7 and ULID start with a 48 bit unix timestamp in milliseconds,
+//			followed by random bits, so they sort by creation time. This keeps
+//			database indexes compact compared to random keys.
+//		Snowflake IDs are uint64: timestamp, then node number, then sequence.
+//			The layout is configurable. Twitter's is 41 timestamp bits, 10 node
+//			bits and 12 sequence bits (the top bit is always zero).
+
+//		Monotonic ordering: IDs made by this process in the same millisecond
+//			still sort in creation order. UUIDv7 uses its 12 "rand_a" bits as a
+//			counter (RFC 9562 section 6.2, method 1), ULID increments its random
+//			part, Snowflake increments its sequence. If a counter runs out within
+//			a millisecond, or the clock goes backwards, the timestamp is moved
+//			forward by a millisecond rather than waiting, so generation never
+//			blocks (timestamps can then be slightly ahead of the clock).
+
+//		Random bits come from RandomBytes, so they follow SetRandomSource.
+//			Timestamps come from the current Clock, so they follow SetClock.
+
+// 128 bit UUID
+type UUID [16]byte
+
+// 128 bit ULID
+type ULID [16]byte
+
+// Snowflake ID generator for one node
+type Snowflake struct {
+	lock     sync.Mutex
+	epoch    uint64
+	node     uint64
+	nodeBits uint
+	seqBits  uint
+	started  bool
+	lastMs   uint64
+	seq      uint64
+}
+
+// Returns a random (version 4) UUID
+func NewUUIDv4() (UUID, error) {
+	u := UUID{}
+	b, err := RandomBytes(16)
+	if err != nil {
+		return u, errors.Wrap(err, "wiz.NewUUIDv4")
+	}
+	copy(u[:], b)
+	u[6] = u[6]&0x0f | 0x40 //Version 4
+	u[8] = u[8]&0x3f | 0x80 //Variant 10
+	return u, nil
+}
+
+// Returns a time-ordered (version 7) UUID
+func NewUUIDv7() (UUID, error) {
+	u := UUID{}
+	b, err := RandomBytes(10)
+	if err != nil {
+		return u, errors.Wrap(err, "wiz.NewUUIDv7")
+	}
+	idLock.Lock()
+	ms := uuidLastMs
+	now := idNowMillis()
+	if now > ms {
+		//New millisecond: start the counter at a random value in the lower half of its range
+		ms = now
+		uuidCounter = uint64(binary.BigEndian.Uint16(b[0:2])) & 0x7ff
+	} else {
+		uuidCounter++
+		if uuidCounter > 0xfff {
+			ms++
+			uuidCounter = 0
+		}
+	}
+	uuidLastMs = ms
+	counter := uuidCounter
+	idLock.Unlock()
+	if ms >= 1<<48 {
+		return u, errors.New("wiz.NewUUIDv7: timestamp out of range")
+	}
+	putUint48(u[0:6], ms)
+	binary.BigEndian.PutUint16(u[6:8], uint16(0x7000|counter))
+	copy(u[8:], b[2:])
+	u[8] = u[8]&0x3f | 0x80 //Variant 10
+	return u, nil
+}
+
+// Parses a UUID in canonical form (8-4-4-4-12 hex digits), with or without hyphens, braces or a "urn:uuid:" prefix. Case-insensitive.
+func ParseUUID(s string) (UUID, error) {
+	u, err := parseUUID(s)
+	return u, errors.Wrap(err, "wiz.ParseUUID")
+}
+
+// Returns the UUID in canonical lowercase form, e.g. "0189f7c8-1a2b-7c3d-8e4f-a1b2c3d4e5f6"
+func (u UUID) String() string {
+	h := hex.EncodeToString(u[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// Returns the UUID version (4 for NewUUIDv4, 7 for NewUUIDv7)
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+// Returns the unix timestamp in milliseconds embedded in a version 7 UUID
+func (u UUID) Timestamp() (uint64, error) {
+	if u.Version() != 7 {
+		return 0, errors.New("wiz.UUID.Timestamp: not a version 7 UUID")
+	}
+	return getUint48(u[0:6]), nil
+}
+
+// Encodes the UUID in canonical form (so JSON contains a string, not an array)
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// Parses a UUID using ParseUUID
+func (u *UUID) UnmarshalText(b []byte) error {
+	parsed, err := ParseUUID(string(b))
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
+
+// Returns a new ULID
+func NewULID() (ULID, error) {
+	u := ULID{}
+	b, err := RandomBytes(10)
+	if err != nil {
+		return u, errors.Wrap(err, "wiz.NewULID")
+	}
+	idLock.Lock()
+	ms := ulidLastMs
+	now := idNowMillis()
+	if now > ms {
+		ms = now
+		copy(ulidRandom[:], b)
+	} else {
+		//Same millisecond: increment the 80 bit random part
+		carry := true
+		for i := 9; i >= 0 && carry; i-- {
+			ulidRandom[i]++
+			carry = ulidRandom[i] == 0
+		}
+		if carry {
+			ms++
+			copy(ulidRandom[:], b)
+		}
+	}
+	ulidLastMs = ms
+	copy(u[6:], ulidRandom[:])
+	idLock.Unlock()
+	if ms >= 1<<48 {
+		return u, errors.New("wiz.NewULID: timestamp out of range")
+	}
+	putUint48(u[0:6], ms)
+	return u, nil
+}
+
+// Parses a 26 character ULID. Case-insensitive; I and L are read as 1, O as 0.
+func ParseULID(s string) (ULID, error) {
+	u, err := parseULID(s)
+	return u, errors.Wrap(err, "wiz.ParseULID")
+}
+
+// Returns the ULID as 26 uppercase Crockford base32 characters
+func (u ULID) String() string {
+	hi := binary.BigEndian.Uint64(u[0:8])
+	lo := binary.BigEndian.Uint64(u[8:16])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// Returns the unix timestamp in milliseconds embedded in the ULID
+func (u ULID) Timestamp() uint64 {
+	return getUint48(u[0:6])
+}
+
+// Encodes the ULID as its string form (so JSON contains a string, not an array)
+func (u ULID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// Parses a ULID using ParseULID
+func (u *ULID) UnmarshalText(b []byte) error {
+	parsed, err := ParseULID(string(b))
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
+
+// Creates a Snowflake generator. Epoch is a unix timestamp in milliseconds that IDs count from. Node must fit in nodeBits. Whatever nodeBits and sequenceBits leave of 63 bits is used for the timestamp (at least 32).
+func NewSnowflake(epoch uint64, node uint64, nodeBits, sequenceBits uint) (*Snowflake, error) {
+	if nodeBits+sequenceBits > 31 {
+		return nil, errors.New("wiz.NewSnowflake: node and sequence bits leave fewer than 32 timestamp bits")
+	}
+	if node >= 1<<nodeBits {
+		return nil, errors.New("wiz.NewSnowflake: node does not fit in " + strconv.Itoa(int(nodeBits)) + " bits")
+	}
+	if epoch > idNowMillis() {
+		return nil, errors.New("wiz.NewSnowflake: epoch is in the future")
+	}
+	return &Snowflake{epoch: epoch, node: node, nodeBits: nodeBits, seqBits: sequenceBits}, nil
+}
+
+// Returns the next ID
+func (s *Snowflake) Next() (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := idNowMillis()
+	if now < s.epoch {
+		now = s.epoch
+	}
+	ms := now - s.epoch
+	if ms > s.lastMs || !s.started {
+		s.started = true
+		s.lastMs = ms
+		s.seq = 0
+	} else {
+		s.seq++
+		if s.seq >= 1<<s.seqBits {
+			s.lastMs++
+			s.seq = 0
+		}
+	}
+	timeBits := 63 - s.nodeBits - s.seqBits
+	if s.lastMs >= 1<<timeBits {
+		return 0, errors.New("wiz.Snowflake.Next: timestamp no longer fits, choose a later epoch")
+	}
+	return s.lastMs<<(s.nodeBits+s.seqBits) | s.node<<s.seqBits | s.seq, nil
+}
+
+// Returns the unix timestamp in milliseconds of an ID made by this generator (or one with the same layout and epoch)
+func (s *Snowflake) Timestamp(id uint64) uint64 {
+	return id>>(s.nodeBits+s.seqBits) + s.epoch
+}
+
+// Returns the node number of an ID
+func (s *Snowflake) Node(id uint64) uint64 {
+	return id >> s.seqBits & (1<<s.nodeBits - 1)
+}
+
+// Returns the sequence number of an ID
+func (s *Snowflake) Sequence(id uint64) uint64 {
+	return id & (1<<s.seqBits - 1)
+}
+
+//
+//
+//
+//
+//
+
+// ParseUUID, with unprefixed errors
+func parseUUID(s string) (UUID, error) {
+	u := UUID{}
+	trimmed, shift := s, 0 //shift is the offset of trimmed within s, for errors
+	for _, prefix := range []string{"urn:uuid:", "URN:UUID:"} {
+		if strings.HasPrefix(trimmed, prefix) {
+			trimmed, shift = trimmed[len(prefix):], len(prefix)
+		}
+	}
+	if strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}") {
+		trimmed, shift = trimmed[1:len(trimmed)-1], shift+1
+	}
+	digits := []byte{}
+	for i := 0; i < len(trimmed); i++ {
+		c := trimmed[i]
+		if c == '-' && len(trimmed) == 36 && (i == 8 || i == 13 || i == 18 || i == 23) {
+			continue
+		}
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+			return u, &DecodeError{"uuid", shift + i, "invalid character " + strconv.QuoteRune(rune(c))}
+		}
+		digits = append(digits, c)
+	}
+	if len(digits) != 32 || (len(trimmed) != 32 && len(trimmed) != 36) {
+		return u, &DecodeError{"uuid", len(s), "invalid length"}
+	}
+	hex.Decode(u[:], digits)
+	return u, nil
+}
+
+// ParseULID, with unprefixed errors
+func parseULID(s string) (ULID, error) {
+	u := ULID{}
+	if len(s) != 26 {
+		return u, &DecodeError{"ulid", len(s), "ULIDs are 26 characters"}
+	}
+	var hi, lo uint64
+	for i := 0; i < 26; i++ {
+		v := crockfordValue(s[i])
+		if v < 0 || (i == 0 && v > 7) {
+			return u, &DecodeError{"ulid", i, "invalid character " + strconv.QuoteRune(rune(s[i]))}
+		}
+		//Shift the 128 bit value left by 5 and add v
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+	binary.BigEndian.PutUint64(u[0:8], hi)
+	binary.BigEndian.PutUint64(u[8:16], lo)
+	return u, nil
+}
+
+var idLock sync.Mutex
+var uuidLastMs, uuidCounter uint64
+var ulidLastMs uint64
+var ulidRandom [10]byte
+
+func idNowMillis() uint64 {
+	return uint64(currentClock().Now().UnixNano() / int64(time.Millisecond))
+}
+
+func putUint48(b []byte, n uint64) {
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(n)
+		n >>= 8
+	}
+}
+
+func getUint48(b []byte) uint64 {
+	n := uint64(0)
+	for i := 0; i < 6; i++ {
+		n = n<<8 | uint64(b[i])
+	}
+	return n
+}
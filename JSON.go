@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"github.com/pkg/errors"
+	"sync"
 )
 
 //		This package is json.Marshal but with some extra formatting.
@@ -24,7 +25,7 @@ import (
 var jsonencoder *json.Encoder = nil
 var jsoninitialized = false
 var jsonencbuf = new(bytes.Buffer)
-var jsonlocked = false
+var jsonlock sync.Mutex
 
 func jsonInit() {
 	if !jsoninitialized {
@@ -35,16 +36,13 @@ func jsonInit() {
 }
 
 func jsonLock() {
-	for jsonlocked {
-
-	}
+	jsonlock.Lock() //Lock encbuf
 	jsonInit()
-	jsonlocked = true //Lock encbuf
 	jsonencbuf.Reset()
 }
 
 func jsonUnlock() {
-	jsonlocked = false
+	jsonlock.Unlock()
 }
 
 ////////////////////////
@@ -81,7 +79,9 @@ func Marshal(payload interface{}) ([]byte, error) {
 	if err != nil {
 		return []byte{}, errors.Wrap(err, "wiz.Marshal")
 	}
-	b := jsonencbuf.Bytes()
+	//Copy out of encbuf, which is reused by the next call
+	b := make([]byte, jsonencbuf.Len())
+	copy(b, jsonencbuf.Bytes())
 	return b, nil
 }
 
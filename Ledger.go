@@ -0,0 +1,299 @@
+package wiz
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//		Tamper-evident ledger of numbered blocks, stored as files.
+
+//		Blocks are numbered 1,2,3,... with no gaps (block zero does not exist).
+//			Each block holds the Hash of the block before it (64 zero bytes for
+//			block 1), so changing any block breaks every block after it.
+//			Verify walks the whole chain from block 1 and reports the first
+//			block that does not check out.
+
+//		A block's Hash covers its Number, Timestamp, Previous, Data and Signer.
+//			If the ledger was opened with a key pair, each block also carries an
+//			EdSign signature of its Hash, and Verify requires every block to be
+//			signed by that key.
+
+//		Each block is one JSON file in the ledger's directory, named after its
+//			number (e.g. "ledger/12.json"), written atomically and never
+//			overwritten.
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+//		Example:
+//		l, err := OpenLedger("ledger", pub, pri) //or nil, nil for unsigned
+//		b, err := l.Append([]byte("some record"))
+//		err = l.Verify()
+//		go ServeSimple(ln, l.Getter(), somePoster)
+//			GET /blocks          -> {"Latest":12}
+//			GET /blocks/latest   -> block 12
+//			GET /blocks/1234     -> block 1234 (404 if it does not exist)
+//			GET /verify          -> 200 if the chain verifies, 409 if not
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+// A single numbered entry in a Ledger
+type Block struct {
+	Number    uint64
+	Timestamp uint64
+	Previous  []byte
+	Data      []byte
+	Signer    []byte
+	Signature []byte
+	Hash      []byte
+}
+
+// Append-only chain of blocks persisted in a directory
+type Ledger struct {
+	lock       sync.RWMutex
+	dir        string
+	publicKey  []byte
+	privateKey []byte
+	latest     Block
+}
+
+// Opens (or creates) a ledger at a given relative path (relative to Dir()). Keys may be nil for an unsigned ledger. Returns an error if block numbers on disk have gaps. Does not verify the chain (use Verify).
+func OpenLedger(dir string, publicKey, privateKey []byte) (*Ledger, error) {
+	if (publicKey == nil) != (privateKey == nil) {
+		return nil, errors.New("wiz.OpenLedger: provide both keys or neither")
+	}
+	if publicKey != nil {
+		_, err := EdSign([]byte("wiz.OpenLedger"), publicKey, privateKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "wiz.OpenLedger")
+		}
+	}
+	l := &Ledger{dir: filepath.FromSlash(Dir() + dir), publicKey: publicKey, privateKey: privateKey}
+	err := os.MkdirAll(l.dir, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "wiz.OpenLedger")
+	}
+	numbers, err := l.numbers()
+	if err != nil {
+		return nil, errors.Wrap(err, "wiz.OpenLedger")
+	}
+	for i, n := range numbers {
+		if n != uint64(i+1) {
+			return nil, errors.New("wiz.OpenLedger: block " + strconv.Itoa(i+1) + " is missing")
+		}
+	}
+	if len(numbers) > 0 {
+		l.latest, err = l.read(numbers[len(numbers)-1])
+		if err != nil {
+			return nil, errors.Wrap(err, "wiz.OpenLedger")
+		}
+	}
+	return l, nil
+}
+
+// Appends data as a new block, numbered one after the latest. Returns the new block.
+func (l *Ledger) Append(data []byte) (Block, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	b := Block{
+		Number:    l.latest.Number + 1,
+		Timestamp: Now(),
+		Previous:  l.latest.Hash,
+		Data:      data,
+		Signer:    l.publicKey,
+	}
+	if b.Number == 1 {
+		b.Previous = make([]byte, 64)
+	}
+	b.Hash = Hash(b.encode())
+	if l.privateKey != nil {
+		sig, err := EdSign(b.Hash, l.publicKey, l.privateKey)
+		if err != nil {
+			return Block{}, errors.Wrap(err, "wiz.Ledger.Append")
+		}
+		b.Signature = sig
+	}
+	path := l.path(b.Number)
+	if _, err := os.Stat(path); err == nil {
+		return Block{}, errors.New("wiz.Ledger.Append: block " + strconv.FormatUint(b.Number, 10) + " already exists on disk")
+	}
+	j, err := Marshal(b)
+	if err == nil {
+		err = writeFileAtomic(path, j)
+	}
+	if err != nil {
+		return Block{}, errors.Wrap(err, "wiz.Ledger.Append")
+	}
+	l.latest = b
+	return b, nil
+}
+
+// Returns the number of the latest block (zero if the ledger is empty)
+func (l *Ledger) Latest() uint64 {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.latest.Number
+}
+
+// Reads a block by number from disk
+func (l *Ledger) Block(number uint64) (Block, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if number < 1 || number > l.latest.Number {
+		return Block{}, errors.New("wiz.Ledger.Block: no block " + strconv.FormatUint(number, 10))
+	}
+	b, err := l.read(number)
+	if err != nil {
+		return Block{}, errors.Wrap(err, "wiz.Ledger.Block")
+	}
+	return b, nil
+}
+
+// Re-reads every block from disk, starting at block 1, and checks numbering, hashes, links to previous blocks and signatures. Error is nil only if the whole chain is intact.
+func (l *Ledger) Verify() error {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	previous := make([]byte, 64)
+	for n := uint64(1); n <= l.latest.Number; n++ {
+		b, err := l.read(n)
+		if err != nil {
+			return errors.Wrap(err, "wiz.Ledger.Verify")
+		}
+		err = b.check(n, previous, l.publicKey)
+		if err != nil {
+			return errors.Wrap(err, "wiz.Ledger.Verify: block "+strconv.FormatUint(n, 10))
+		}
+		previous = b.Hash
+	}
+	if l.latest.Number > 0 && !bytes.Equal(previous, l.latest.Hash) {
+		return errors.New("wiz.Ledger.Verify: latest block changed on disk")
+	}
+	return nil
+}
+
+// Returns a read-only GET handler for use with ServeSimple. See the top of Ledger.go for routes.
+func (l *Ledger) Getter() func([]string) (int, []byte) {
+	return func(url []string) (int, []byte) {
+		respond := func(payload interface{}) (int, []byte) {
+			j, err := Marshal(payload)
+			if err != nil {
+				return 500, []byte("wiz.Ledger.Getter: " + err.Error())
+			}
+			return 200, j
+		}
+		switch {
+		case len(url) == 1 && url[0] == "blocks":
+			return respond(struct{ Latest uint64 }{l.Latest()})
+		case len(url) == 2 && url[0] == "blocks":
+			n := l.Latest()
+			if url[1] != "latest" {
+				parsed, err := Uint64(url[1])
+				if err != nil {
+					return 400, []byte("wiz.Ledger.Getter: invalid block number")
+				}
+				n = parsed
+			}
+			b, err := l.Block(n)
+			if err != nil {
+				return 404, []byte(err.Error())
+			}
+			return respond(b)
+		case len(url) == 1 && url[0] == "verify":
+			err := l.Verify()
+			if err != nil {
+				return 409, []byte(err.Error())
+			}
+			return respond(struct{ Valid bool }{true})
+		}
+		return 404, []byte("wiz.Ledger.Getter: not found")
+	}
+}
+
+//
+//
+//
+//
+//
+
+// Deterministic encoding of the hashed fields. Numbers are 8 byte big-endian,
+// byte slices are prefixed with their length as 8 byte big-endian.
+func (b *Block) encode() []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, b.Number)
+	binary.Write(buf, binary.BigEndian, b.Timestamp)
+	for _, field := range [][]byte{b.Previous, b.Data, b.Signer} {
+		binary.Write(buf, binary.BigEndian, uint64(len(field)))
+		buf.Write(field)
+	}
+	return buf.Bytes()
+}
+
+// Checks a single block given its expected number, the previous block's hash,
+// and the key it must be signed with (nil if signing is not required)
+func (b *Block) check(number uint64, previous []byte, publicKey []byte) error {
+	if b.Number != number {
+		return errors.New("wrong number " + strconv.FormatUint(b.Number, 10))
+	}
+	if !bytes.Equal(b.Previous, previous) {
+		return errors.New("does not link to previous block")
+	}
+	if !HashMatch(b.encode(), b.Hash) {
+		return errors.New("hash mismatch")
+	}
+	if publicKey != nil && !bytes.Equal(b.Signer, publicKey) {
+		return errors.New("not signed by ledger key")
+	}
+	if len(b.Signer) > 0 {
+		err := EdVerify(b.Hash, b.Signature, b.Signer)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Ledger) path(number uint64) string {
+	return filepath.Join(l.dir, strconv.FormatUint(number, 10)+".json")
+}
+
+func (l *Ledger) read(number uint64) (Block, error) {
+	j, err := ioutil.ReadFile(l.path(number))
+	if err != nil {
+		return Block{}, err
+	}
+	b := Block{}
+	err = json.Unmarshal(j, &b)
+	return b, err
+}
+
+// Sorted block numbers of every block file in the ledger directory
+func (l *Ledger) numbers() ([]uint64, error) {
+	files, err := ioutil.ReadDir(l.dir)
+	if err != nil {
+		return []uint64{}, err
+	}
+	numbers := []uint64{}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSuffix(name, ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers, nil
+}
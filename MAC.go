@@ -0,0 +1,89 @@
+package wiz
+
+import (
+	"crypto/hmac"
+	"crypto/subtle"
+	sha3 "golang.org/x/crypto/sha3"
+)
+
+//		Keyed hashing (message authentication codes)
+
+//		HMAC uses SHA3-512 as its hash function, so outputs are 64 bytes like Hash.
+//		KMAC is KMAC256 as defined in NIST SP 800-185, also with a 64 byte output.
+//			It takes an optional customization string, which acts as a domain
+//			separator (e.g. "webhook" vs "cookie") so that the same key can be used
+//			for different purposes without one MAC being valid for the other.
+
+//		Always compare MACs using MACVerify (constant time) and never with == or
+//			bytes.Equal, which leak how many leading bytes matched.
+
+// HMAC returns the HMAC-SHA3-512 of data using a given key. Output is 64 bytes.
+func HMAC(data, key []byte) []byte {
+	mac := hmac.New(sha3.New512, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// KMAC returns the KMAC256 of data using a given key and customization string. Output is 64 bytes.
+func KMAC(data, key, customization []byte) []byte {
+	const rate = 136 //Rate of cSHAKE256 in bytes
+	const outBits = 512
+	h := sha3.NewCShake256([]byte("KMAC"), customization)
+	h.Write(kmacBytepad(kmacEncodeString(key), rate))
+	h.Write(data)
+	h.Write(kmacRightEncode(outBits))
+	out := make([]byte, outBits/8)
+	h.Read(out)
+	return out
+}
+
+// MACVerify compares a computed MAC to an expected one in constant time. Returns false if lengths differ or either is empty.
+func MACVerify(mac, expected []byte) bool {
+	if len(mac) == 0 || len(mac) != len(expected) {
+		return false
+	}
+	return subtle.ConstantTimeCompare(mac, expected) == 1
+}
+
+//
+//
+//
+//
+//
+
+//The following encodings are from NIST SP 800-185 section 2.3
+
+func kmacLeftEncode(x uint64) []byte {
+	b := kmacEncodeInt(x)
+	return append([]byte{byte(len(b))}, b...)
+}
+
+func kmacRightEncode(x uint64) []byte {
+	b := kmacEncodeInt(x)
+	return append(b, byte(len(b)))
+}
+
+// Big-endian bytes of x with no leading zeroes (but at least one byte)
+func kmacEncodeInt(x uint64) []byte {
+	b := []byte{}
+	for x > 0 {
+		b = append([]byte{byte(x)}, b...)
+		x >>= 8
+	}
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	return b
+}
+
+func kmacEncodeString(s []byte) []byte {
+	return append(kmacLeftEncode(uint64(len(s))*8), s...)
+}
+
+func kmacBytepad(x []byte, w int) []byte {
+	b := append(kmacLeftEncode(uint64(w)), x...)
+	for len(b)%w != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
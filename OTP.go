@@ -0,0 +1,209 @@
+package wiz
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//		One-time passwords for second-factor login: HOTP (RFC 4226, counter
+//			based) and TOTP (RFC 6238, time based), as used by authenticator apps.
+
+//		Secrets are base32 strings, as authenticator apps expect. NewOTPSecret
+//			makes one from 20 random bytes. When reading secrets, case, spaces,
+//			hyphens and padding are ignored, so "jbsw y3dp-ehpk 3pxp" is fine.
+//			Keep secrets as safe as passwords: anyone with one can make codes.
+
+//		TOTP codes change every Period seconds. VerifyTOTP accepts codes from
+//			up to Skew periods either side of now, to allow for clock drift and
+//			slow typing. VerifyHOTP looks up to Skew counters ahead, in case codes
+//			were generated but not used, and returns the counter to store next.
+//			Neither stops a code being used twice within its window; callers that
+//			care should remember the last accepted counter or time step.
+
+//		Most authenticator apps only support the defaults (SHA1, 6 digits, 30
+//			seconds), whatever the provisioning URI says.
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+//		Example:
+//		secret, err := NewOTPSecret()	//Store with the user's account
+//		uri := TOTPURI(secret, "Example", "alice@example.com", DefaultOTPOptions)
+//		//Show uri as a QR code, then at login:
+//		ok, err := VerifyTOTP(secret, codeFromUser, DefaultOTPOptions)
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+// Settings for one-time passwords. Digits is 6 to 10, Algorithm is "SHA1", "SHA256" or "SHA512", Period is in seconds (TOTP only).
+type OTPOptions struct {
+	Digits    int
+	Algorithm string
+	Period    uint64
+	Skew      int
+}
+
+// 6 digits, SHA1, 30 second periods, one period (or counter) of skew
+var DefaultOTPOptions = OTPOptions{Digits: 6, Algorithm: "SHA1", Period: 30, Skew: 1}
+
+// Returns a new random secret, base32 encoded (160 bits, as RFC 4226 recommends)
+func NewOTPSecret() (string, error) {
+	b, err := RandomBytes(20)
+	if err != nil {
+		return "", errors.Wrap(err, "wiz.NewOTPSecret")
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+// Returns the HOTP code for a counter
+func HOTP(secret string, counter uint64, opts OTPOptions) (string, error) {
+	key, newHash, err := otpSetup(secret, opts)
+	if err != nil {
+		return "", errors.Wrap(err, "wiz.HOTP")
+	}
+	return otpCode(key, newHash, counter, opts.Digits), nil
+}
+
+// Checks an HOTP code against counter and the Skew counters after it. If it matches, returns the counter to use next time.
+func VerifyHOTP(secret, code string, counter uint64, opts OTPOptions) (uint64, bool, error) {
+	key, newHash, err := otpSetup(secret, opts)
+	if err != nil {
+		return counter, false, errors.Wrap(err, "wiz.VerifyHOTP")
+	}
+	for i := 0; i <= opts.Skew; i++ {
+		if MACVerify([]byte(otpCode(key, newHash, counter+uint64(i), opts.Digits)), []byte(code)) {
+			return counter + uint64(i) + 1, true, nil
+		}
+	}
+	return counter, false, nil
+}
+
+// Returns the TOTP code for a time
+func TOTP(secret string, t time.Time, opts OTPOptions) (string, error) {
+	if opts.Period == 0 {
+		return "", errors.New("wiz.TOTP: zero period")
+	}
+	code, err := HOTP(secret, TimeToUnix(t)/opts.Period, opts)
+	return code, errors.Wrap(err, "wiz.TOTP")
+}
+
+// Checks a TOTP code against the current time (from the current Clock), allowing Skew periods either side
+func VerifyTOTP(secret, code string, opts OTPOptions) (bool, error) {
+	ok, err := verifyTOTP(secret, code, currentClock().Now(), opts)
+	return ok, errors.Wrap(err, "wiz.VerifyTOTP")
+}
+
+// Checks a TOTP code against a given time, allowing Skew periods either side
+func VerifyTOTPAt(secret, code string, t time.Time, opts OTPOptions) (bool, error) {
+	ok, err := verifyTOTP(secret, code, t, opts)
+	return ok, errors.Wrap(err, "wiz.VerifyTOTPAt")
+}
+
+// Returns an otpauth://totp/ provisioning URI (usually shown as a QR code) for authenticator apps
+func TOTPURI(secret, issuer, account string, opts OTPOptions) string {
+	return otpURI("totp", secret, issuer, account, opts, "period="+strconv.FormatUint(opts.Period, 10))
+}
+
+// Returns an otpauth://hotp/ provisioning URI, starting at a given counter
+func HOTPURI(secret, issuer, account string, counter uint64, opts OTPOptions) string {
+	return otpURI("hotp", secret, issuer, account, opts, "counter="+strconv.FormatUint(counter, 10))
+}
+
+//
+//
+//
+//
+//
+
+// VerifyTOTP at time t, with unprefixed errors
+func verifyTOTP(secret, code string, t time.Time, opts OTPOptions) (bool, error) {
+	if opts.Period == 0 {
+		return false, errors.New("zero period")
+	}
+	key, newHash, err := otpSetup(secret, opts)
+	if err != nil {
+		return false, err
+	}
+	step := TimeToUnix(t) / opts.Period
+	ok := false
+	for i := -opts.Skew; i <= opts.Skew; i++ {
+		if i < 0 && uint64(-i) > step {
+			continue
+		}
+		//Check every step, so timing doesn't reveal which one matched
+		if MACVerify([]byte(otpCode(key, newHash, step+uint64(i), opts.Digits)), []byte(code)) {
+			ok = true
+		}
+	}
+	return ok, nil
+}
+
+// Decodes the secret and checks options
+func otpSetup(secret string, opts OTPOptions) ([]byte, func() hash.Hash, error) {
+	if opts.Digits < 6 || opts.Digits > 10 {
+		return nil, nil, errors.New("digits must be 6 to 10")
+	}
+	newHash, ok := otpAlgorithms[strings.ToUpper(opts.Algorithm)]
+	if !ok {
+		return nil, nil, errors.New("unknown algorithm " + strconv.Quote(opts.Algorithm))
+	}
+	normal := strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(secret))
+	key, err := base32RawToBytes(normal)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "secret")
+	}
+	if len(key) == 0 {
+		return nil, nil, errors.New("empty secret")
+	}
+	return key, newHash, nil
+}
+
+// RFC 4226 section 5.3: HMAC the counter, then dynamic truncation
+func otpCode(key []byte, newHash func() hash.Hash, counter uint64, digits int) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(newHash, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	n := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+	modulus := uint64(1)
+	for i := 0; i < digits; i++ {
+		modulus *= 10
+	}
+	code := strconv.FormatUint(n%modulus, 10)
+	return strings.Repeat("0", digits-len(code)) + code
+}
+
+var otpAlgorithms = map[string]func() hash.Hash{
+	"SHA1":   sha1.New,
+	"SHA256": sha256.New,
+	"SHA512": sha512.New,
+}
+
+// Key URI format: otpauth://TYPE/ISSUER:ACCOUNT?secret=...&issuer=...
+func otpURI(kind, secret, issuer, account string, opts OTPOptions, extra string) string {
+	escape := func(s string) string {
+		return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+	}
+	label := escape(account)
+	if issuer != "" {
+		label = escape(issuer) + ":" + label
+	}
+	query := "secret=" + strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(secret))
+	if issuer != "" {
+		query += "&issuer=" + escape(issuer)
+	}
+	query += "&algorithm=" + strings.ToUpper(opts.Algorithm) + "&digits=" + strconv.Itoa(opts.Digits) + "&" + extra
+	return "otpauth://" + kind + "/" + label + "?" + query
+}
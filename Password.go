@@ -0,0 +1,206 @@
+package wiz
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"strconv"
+	"strings"
+)
+
+//		Password hashing using Argon2id.
+
+//		Do not store passwords using Hash. SHA3 is fast and unsalted, which is
+//			exactly what you do not want here: identical passwords get identical
+//			hashes and an attacker can try billions of guesses per second.
+//			Argon2id is salted and deliberately slow and memory hungry.
+
+//		Output is a PHC formatted string, which stores everything needed to
+//			verify the password later (algorithm, version, cost, salt and key):
+//				$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+//			with salt and key in unpadded standard base64.
+
+//		Costs can be raised over time. NeedsRehash reports when a stored hash was
+//			made with different parameters, so it can be replaced at next login
+//			(which is the only time the plaintext password is available).
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+//		Example:
+//		stored, err := HashPassword(password)
+//		...
+//		ok, err := VerifyPassword(attempt, stored)
+//		if ok && NeedsRehash(stored, DefaultPasswordParams) {
+//			stored, err = HashPassword(attempt)
+//		}
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+// Cost parameters for Argon2id. Memory is in KiB. Hashes asking for more than 2 GiB, 100 iterations, or salts or keys over 1024 bytes are refused, so a crafted hash can't tie up a server.
+type PasswordParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Parameters used by HashPassword. 64 MiB of memory and three passes.
+var DefaultPasswordParams = PasswordParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Hashes a password using Argon2id with DefaultPasswordParams and a random salt. Returns a PHC formatted string.
+func HashPassword(password string) (string, error) {
+	s, err := HashPasswordWith(password, DefaultPasswordParams)
+	if err != nil {
+		return "", errors.Wrap(err, "wiz.HashPassword")
+	}
+	return s, nil
+}
+
+// Hashes a password using Argon2id with given parameters and a random salt. Returns a PHC formatted string.
+func HashPasswordWith(password string, params PasswordParams) (string, error) {
+	err := params.check()
+	if err != nil {
+		return "", errors.Wrap(err, "wiz.HashPasswordWith")
+	}
+	salt, err := RandomBytes(int(params.SaltLength))
+	if err != nil {
+		return "", errors.Wrap(err, "wiz.HashPasswordWith")
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	b64 := base64.RawStdEncoding
+	s := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism, b64.EncodeToString(salt), b64.EncodeToString(key))
+	return s, nil
+}
+
+// Checks a password against a PHC formatted Argon2id hash, in constant time. Error is non-nil only if the hash could not be parsed.
+func VerifyPassword(password, encoded string) (bool, error) {
+	params, salt, key, err := parsePasswordHash(encoded)
+	if err != nil {
+		return false, errors.Wrap(err, "wiz.VerifyPassword")
+	}
+	attempt := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(attempt, key) == 1, nil
+}
+
+// Returns true if a PHC formatted hash was not made with the given parameters (or cannot be parsed), meaning it should be replaced.
+func NeedsRehash(encoded string, params PasswordParams) bool {
+	old, _, _, err := parsePasswordHash(encoded)
+	if err != nil {
+		return true
+	}
+	return old != params
+}
+
+//
+//
+//
+//
+//
+
+// Limits on parameters, checked before any work is done
+const (
+	maxPasswordMemory     = 2 << 20 //KiB, so 2 GiB
+	maxPasswordIterations = 100
+	maxPasswordBytes      = 1024
+)
+
+func (p PasswordParams) check() error {
+	if p.Iterations < 1 {
+		return errors.New("PasswordParams: Iterations must be at least 1")
+	}
+	if p.Parallelism < 1 {
+		return errors.New("PasswordParams: Parallelism must be at least 1")
+	}
+	if p.Memory < 8*uint32(p.Parallelism) {
+		return errors.New("PasswordParams: Memory must be at least 8 KiB per thread")
+	}
+	if p.SaltLength < 8 {
+		return errors.New("PasswordParams: SaltLength must be at least 8")
+	}
+	if p.KeyLength < 16 {
+		return errors.New("PasswordParams: KeyLength must be at least 16")
+	}
+	if p.Memory > maxPasswordMemory || p.Iterations > maxPasswordIterations {
+		return errors.New("PasswordParams: Memory or Iterations too large")
+	}
+	if p.SaltLength > maxPasswordBytes || p.KeyLength > maxPasswordBytes {
+		return errors.New("PasswordParams: SaltLength or KeyLength too large")
+	}
+	return nil
+}
+
+// Splits a PHC string into its parameters, salt and key
+func parsePasswordHash(encoded string) (PasswordParams, []byte, []byte, error) {
+	params := PasswordParams{}
+	parts := strings.Split(encoded, "$")
+	//Leading $ makes parts[0] empty
+	if len(parts) != 6 || parts[0] != "" {
+		return params, nil, nil, errors.New("malformed password hash")
+	}
+	if parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("unsupported algorithm " + parts[1])
+	}
+	if parts[2] != "v="+strconv.Itoa(argon2.Version) {
+		return params, nil, nil, errors.New("unsupported version " + parts[2])
+	}
+	seen := map[string]bool{}
+	for _, kv := range strings.Split(parts[3], ",") {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 {
+			return params, nil, nil, errors.New("malformed parameter " + kv)
+		}
+		if seen[pair[0]] {
+			return params, nil, nil, errors.New("repeated parameter " + kv)
+		}
+		seen[pair[0]] = true
+		n, err := strconv.ParseUint(pair[1], 10, 32)
+		if err != nil {
+			return params, nil, nil, errors.Wrap(err, "malformed parameter "+kv)
+		}
+		switch pair[0] {
+		case "m":
+			params.Memory = uint32(n)
+		case "t":
+			params.Iterations = uint32(n)
+		case "p":
+			if n > 255 {
+				return params, nil, nil, errors.New("parallelism out of range")
+			}
+			params.Parallelism = uint8(n)
+		default:
+			return params, nil, nil, errors.New("unknown parameter " + kv)
+		}
+	}
+	b64 := base64.RawStdEncoding
+	//Check sizes before decoding, and costs before anyone runs Argon2 with them
+	if len(parts[4]) > maxPasswordBytes*2 || len(parts[5]) > maxPasswordBytes*2 {
+		return params, nil, nil, errors.New("salt or key too long")
+	}
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errors.Wrap(err, "malformed salt")
+	}
+	key, err := b64.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, errors.Wrap(err, "malformed key")
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	err = params.check()
+	if err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
@@ -1,19 +1,229 @@
 package wiz
 
 import (
-	"crypto/rand"
+	"encoding/binary"
 	"github.com/pkg/errors"
+	"io"
+	"reflect"
+	"unicode/utf8"
 )
 
-// RandomBytes returns byte slice of length n filled with random data (uses crypto/rand)
+//		Cryptographically secure randomness (crypto/rand, unless the source has
+//			been swapped: see RandomSource.go).
+//		Random has the same helpers as methods, drawing from a source of its own.
+
+//		Don't write b[0] % n to get a number below n. Unless n divides 256 some
+//			results come up more often than others (modulo bias). The helpers
+//			below use rejection sampling instead: draws that would cause bias are
+//			thrown away and redrawn, so every outcome is equally likely.
+
+// RandomBytes returns byte slice of length n filled with random data (uses the current RandomSource, crypto/rand by default)
 func RandomBytes(len int) ([]byte, error) {
+	b, err := randomBytes(currentRandomSource(), len)
+	return b, errors.Wrap(err, "wiz.RandomBytes")
+}
+
+// Like RandomBytes, but reads from a given source, whatever SetRandomSource has swapped in
+func RandomBytesFrom(source RandomSource, len int) ([]byte, error) {
+	b, err := randomBytes(source, len)
+	return b, errors.Wrap(err, "wiz.RandomBytesFrom")
+}
+
+// RandomInt returns a uniformly distributed integer between min and max, inclusive
+func RandomInt(min, max int) (int, error) {
+	n, err := randomInt(currentRandomSource(), min, max)
+	return n, errors.Wrap(err, "wiz.RandomInt")
+}
+
+// RandomString returns a string of n characters chosen uniformly from an alphabet (which may contain any unicode characters)
+func RandomString(n int, alphabet string) (string, error) {
+	str, err := randomString(currentRandomSource(), n, alphabet)
+	return str, errors.Wrap(err, "wiz.RandomString")
+}
+
+// RandomChoice returns a uniformly chosen element of a slice or array. Type assert the result, e.g. RandomChoice(names) then .(string)
+func RandomChoice(items interface{}) (interface{}, error) {
+	item, err := randomChoice(currentRandomSource(), items)
+	return item, errors.Wrap(err, "wiz.RandomChoice")
+}
+
+// Shuffle randomly reorders a slice in place (Fisher-Yates). Every ordering is equally likely.
+func Shuffle(slice interface{}) error {
+	return errors.Wrap(shuffle(currentRandomSource(), slice), "wiz.Shuffle")
+}
+
+// RandomFloat returns a uniformly distributed float64 in [0, 1)
+func RandomFloat() (float64, error) {
+	f, err := randomFloat(currentRandomSource())
+	return f, errors.Wrap(err, "wiz.RandomFloat")
+}
+
+// The helpers above, drawing from a given Source rather than the current one, so a test can use a seeded source without SetRandomSource. A nil Source means the current RandomSource.
+type Random struct {
+	Source RandomSource
+}
+
+// RandomBytes, from r.Source
+func (r Random) Bytes(len int) ([]byte, error) {
+	b, err := randomBytes(r.source(), len)
+	return b, errors.Wrap(err, "wiz.Random.Bytes")
+}
+
+// RandomInt, from r.Source
+func (r Random) Int(min, max int) (int, error) {
+	n, err := randomInt(r.source(), min, max)
+	return n, errors.Wrap(err, "wiz.Random.Int")
+}
+
+// RandomString, from r.Source
+func (r Random) String(n int, alphabet string) (string, error) {
+	str, err := randomString(r.source(), n, alphabet)
+	return str, errors.Wrap(err, "wiz.Random.String")
+}
+
+// RandomChoice, from r.Source
+func (r Random) Choice(items interface{}) (interface{}, error) {
+	item, err := randomChoice(r.source(), items)
+	return item, errors.Wrap(err, "wiz.Random.Choice")
+}
+
+// Shuffle, from r.Source
+func (r Random) Shuffle(slice interface{}) error {
+	return errors.Wrap(shuffle(r.source(), slice), "wiz.Random.Shuffle")
+}
+
+// RandomFloat, from r.Source
+func (r Random) Float() (float64, error) {
+	f, err := randomFloat(r.source())
+	return f, errors.Wrap(err, "wiz.Random.Float")
+}
+
+//
+//
+//
+//
+//
+
+func (r Random) source() RandomSource {
+	if r.Source == nil {
+		return currentRandomSource()
+	}
+	return r.Source
+}
+
+// The helpers below return unprefixed errors, for the exported functions to wrap
+
+func randomBytes(source RandomSource, len int) ([]byte, error) {
 	if len < 0 {
-		return []byte{}, errors.New("wiz.RandomBytes: Cannot pass negative length")
+		return []byte{}, errors.New("Cannot pass negative length")
 	}
 	b := make([]byte, len)
-	_, err := rand.Read(b)
+	_, err := io.ReadFull(source, b)
 	if err != nil {
-		return []byte{}, errors.Wrap(err, "wiz.RandomBytes")
+		return []byte{}, err
 	}
 	return b, nil
 }
+
+func randomInt(source RandomSource, min, max int) (int, error) {
+	if min > max {
+		return 0, errors.New("min is greater than max")
+	}
+	//Span can be 2^64 - 1 at most; uint64 arithmetic wraps correctly for negative min
+	span := uint64(max) - uint64(min)
+	n, err := randomUint64n(source, span)
+	if err != nil {
+		return 0, err
+	}
+	return int(uint64(min) + n), nil
+}
+
+func randomString(source RandomSource, n int, alphabet string) (string, error) {
+	if n < 0 {
+		return "", errors.New("Cannot pass negative length")
+	}
+	if !utf8.ValidString(alphabet) {
+		return "", errors.New("alphabet is not valid UTF-8")
+	}
+	runes := []rune(alphabet)
+	if len(runes) == 0 {
+		return "", errors.New("empty alphabet")
+	}
+	out := make([]rune, n)
+	for i := range out {
+		j, err := randomUint64n(source, uint64(len(runes)-1))
+		if err != nil {
+			return "", err
+		}
+		out[i] = runes[j]
+	}
+	return string(out), nil
+}
+
+func randomChoice(source RandomSource, items interface{}) (interface{}, error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, errors.New("cannot handle type " + reflect.TypeOf(items).String())
+	}
+	if v.Len() == 0 {
+		return nil, errors.New("no items to choose from")
+	}
+	i, err := randomUint64n(source, uint64(v.Len()-1))
+	if err != nil {
+		return nil, err
+	}
+	return v.Index(int(i)).Interface(), nil
+}
+
+func shuffle(source RandomSource, slice interface{}) error {
+	v := reflect.ValueOf(slice)
+	if v.Kind() != reflect.Slice {
+		return errors.New("cannot handle type " + reflect.TypeOf(slice).String())
+	}
+	swap := reflect.Swapper(slice)
+	for i := v.Len() - 1; i > 0; i-- {
+		j, err := randomUint64n(source, uint64(i))
+		if err != nil {
+			return err
+		}
+		swap(i, int(j))
+	}
+	return nil
+}
+
+func randomFloat(source RandomSource) (float64, error) {
+	n, err := randomUint64(source)
+	if err != nil {
+		return 0, err
+	}
+	//53 random bits fill the mantissa exactly, giving evenly spaced results
+	return float64(n>>11) / (1 << 53), nil
+}
+
+func randomUint64(source RandomSource) (uint64, error) {
+	b, err := randomBytes(source, 8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// Uniform random number in [0, max] using rejection sampling
+func randomUint64n(source RandomSource, max uint64) (uint64, error) {
+	if max == ^uint64(0) {
+		return randomUint64(source)
+	}
+	n := max + 1
+	//Draws above limit fall in an incomplete final block of n values and would
+	// make low results more likely, so they are redrawn
+	limit := ^uint64(0) - (^uint64(0)%n+1)%n
+	for {
+		r, err := randomUint64(source)
+		if err != nil {
+			return 0, err
+		}
+		if r <= limit {
+			return r % n, nil
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package wiz
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"golang.org/x/crypto/chacha20"
+	"sync"
+)
+
+//		Swappable source of randomness.
+
+//		RandomBytes, and every helper built on it (RandomInt, Shuffle, salts in
+//			HashPassword, ...), draw from the current RandomSource. Normally that
+//			is crypto/rand. Tests can make results reproducible with a seeded
+//			source, either passed to just the calls that need it:
+//				r := Random{NewSeededSource([]byte("test seed"))}
+//				n, err := r.Int(1, 6)
+//			or swapped in for everything, including code that can't be passed one:
+//				defer SetRandomSource(NewSeededSource([]byte("test seed")))()
+
+//		The source is global to the whole process, not to the caller.
+//			SetRandomSource holds a lock until its restore function is called,
+//			so tests that swap sources (even with t.Parallel) take turns rather
+//			than using each other's source. But:
+//			- Everything else running meanwhile uses the swapped source too,
+//				including password salts, OTP secrets and IDs made on other
+//				goroutines. Only swap sources in tests, never in a running program.
+//			- Calling SetRandomSource again before restore (from the same
+//				goroutine, or anywhere the first restore is waiting on) blocks
+//				forever. Restore first, or pass the source explicitly instead.
+//		Random's methods (Bytes, Int, String, Choice, Shuffle, Float) and
+//			RandomBytesFrom use the source they are given and ignore the global
+//			one, so prefer them in tests. They are also for code that needs a
+//			particular source whatever else is going on (Random{CryptoSource()}
+//			is always crypto/rand).
+
+//		AESEncrypt nonces always come from crypto/rand, whatever the source.
+
+//		The seeded source is ChaCha20 keyed with the Hash of the seed, and is
+//			safe for concurrent use. With a secret, high-entropy seed its output
+//			is as unpredictable as crypto/rand; with a known seed it is not random
+//			at all, so never use one outside tests.
+
+// Anything random bytes can be read from. Read must fill p entirely or return an error.
+type RandomSource interface {
+	Read(p []byte) (int, error)
+}
+
+// Returns the default source, backed by crypto/rand
+func CryptoSource() RandomSource {
+	return rand.Reader
+}
+
+// Returns a deterministic source: the same seed always produces the same stream of bytes
+func NewSeededSource(seed []byte) RandomSource {
+	s := &seededSource{}
+	copy(s.key[:], Hash(seed))
+	s.rekey()
+	return s
+}
+
+// Replaces the source used by RandomBytes and friends, for the whole process, until the returned function is called. Blocks while another swap is in place (see top of RandomSource.go).
+func SetRandomSource(s RandomSource) (restore func()) {
+	randomScope.Lock()
+	randomLock.Lock()
+	previous := randomSource
+	randomSource = s
+	randomLock.Unlock()
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			randomLock.Lock()
+			randomSource = previous
+			randomLock.Unlock()
+			randomScope.Unlock()
+		})
+	}
+}
+
+//
+//
+//
+//
+//
+
+var randomScope sync.Mutex  //Held while a swapped source is in place
+var randomLock sync.RWMutex //Guards randomSource
+var randomSource = CryptoSource()
+
+func currentRandomSource() RandomSource {
+	randomLock.RLock()
+	defer randomLock.RUnlock()
+	return randomSource
+}
+
+// ChaCha20 keystream. The stream is cut into 1 GiB segments, each with the next
+// nonce, so the 32 bit block counter never runs out.
+type seededSource struct {
+	lock   sync.Mutex
+	key    [32]byte
+	nonce  uint64
+	cipher *chacha20.Cipher
+	left   uint64 //Bytes left in this segment
+}
+
+const seededSegment = 1 << 30
+
+func (s *seededSource) rekey() {
+	nonce := make([]byte, chacha20.NonceSize)
+	binary.BigEndian.PutUint64(nonce[4:], s.nonce)
+	s.nonce++
+	s.cipher, _ = chacha20.NewUnauthenticatedCipher(s.key[:], nonce) //Sizes are always valid
+	s.left = seededSegment
+}
+
+func (s *seededSource) Read(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i := range p {
+		p[i] = 0
+	}
+	done := 0
+	for done < len(p) {
+		if s.left == 0 {
+			s.rekey()
+		}
+		n := len(p) - done
+		if uint64(n) > s.left {
+			n = int(s.left)
+		}
+		s.cipher.XORKeyStream(p[done:done+n], p[done:done+n])
+		s.left -= uint64(n)
+		done += n
+	}
+	return len(p), nil
+}
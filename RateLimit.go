@@ -0,0 +1,275 @@
+package wiz
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+//		Rate limiting, for outgoing calls (Client.SetLimiter) and incoming
+//			requests (ServeLimited).
+
+//		TokenBucket allows bursts: it holds up to burst tokens, refilled at a
+//			steady rate, and each call takes one. SlidingWindow allows at most
+//			limit calls in any window of time, exactly (it remembers when each
+//			of the last limit calls happened).
+
+//		Allow never waits; it returns false if the call would go over the
+//			limit. Wait blocks until the call is allowed, or returns an error
+//			when ctx is done. Both wait on a Clock, so a FakeClock drives them in
+//			tests (nil means the current Clock).
+
+//		KeyedLimiter keeps one limiter per key (an IP address, a user, an API
+//			endpoint), creating them on first use. Limiters not used for the idle
+//			time are forgotten, which is like resetting them, so idle should be
+//			at least as long as a limiter takes to recover fully (burst/rate for
+//			a TokenBucket, the window for a SlidingWindow). An idle of zero or
+//			less means 10 minutes. A key is never forgotten while a Wait on it
+//			is in progress (waiting directly on a limiter from Get doesn't count).
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+//		Client example (at most 5 requests per second, in bursts of up to 10):
+//		c := NewClient(nil, 10)
+//		c.SetLimiter(NewTokenBucket(5, 10, nil))
+
+//		Server example (each IP address gets 100 requests per minute):
+//		perIP := NewKeyedLimiter(func() Limiter {
+//			return NewSlidingWindow(100, time.Minute, nil)
+//		}, time.Minute, nil)
+//		err := ServeLimited(ln, perIP, getter, poster)
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+// Anything that limits how often something happens
+type Limiter interface {
+	Allow() bool
+	Wait(ctx context.Context) error
+}
+
+// Token bucket limiter. Safe for concurrent use.
+type TokenBucket struct {
+	lock   sync.Mutex
+	clock  Clock
+	rate   float64 //Tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// Sliding window limiter. Safe for concurrent use.
+type SlidingWindow struct {
+	lock   sync.Mutex
+	clock  Clock
+	limit  int
+	window time.Duration
+	calls  []time.Time //Oldest first
+}
+
+// One limiter per key, with idle ones evicted. Safe for concurrent use.
+type KeyedLimiter struct {
+	lock       sync.Mutex
+	clock      Clock
+	newLimiter func() Limiter
+	idle       time.Duration
+	limiters   map[string]*keyedLimiterEntry
+	lastSweep  time.Time
+}
+
+// Creates a full token bucket refilling at rate tokens per second, holding at most burst tokens (at least 1)
+func NewTokenBucket(rate float64, burst int, clock Clock) *TokenBucket {
+	if clock == nil {
+		clock = currentClock()
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{clock: clock, rate: rate, burst: float64(burst), tokens: float64(burst), last: clock.Now()}
+}
+
+// Takes a token if there is one
+func (b *TokenBucket) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill()
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+	return false
+}
+
+// Waits for a token and takes it
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.lock.Lock()
+		b.refill()
+		if b.tokens >= 1 {
+			b.tokens--
+			b.lock.Unlock()
+			return nil
+		}
+		if b.rate <= 0 {
+			b.lock.Unlock()
+			<-ctx.Done()
+			return errors.Wrap(ctx.Err(), "wiz.TokenBucket.Wait")
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.lock.Unlock()
+		if err := sleepContext(ctx, b.clock, wait); err != nil {
+			return errors.Wrap(err, "wiz.TokenBucket.Wait")
+		}
+	}
+}
+
+// Creates a limiter allowing at most limit calls in any window
+func NewSlidingWindow(limit int, window time.Duration, clock Clock) *SlidingWindow {
+	if clock == nil {
+		clock = currentClock()
+	}
+	return &SlidingWindow{clock: clock, limit: limit, window: window}
+}
+
+// Records a call if it is within the limit
+func (s *SlidingWindow) Allow() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ok := s.try()
+	return ok
+}
+
+// Waits until a call is within the limit, and records it
+func (s *SlidingWindow) Wait(ctx context.Context) error {
+	for {
+		s.lock.Lock()
+		wait, ok := s.try()
+		s.lock.Unlock()
+		if ok {
+			return nil
+		}
+		if s.limit <= 0 {
+			<-ctx.Done()
+			return errors.Wrap(ctx.Err(), "wiz.SlidingWindow.Wait")
+		}
+		if err := sleepContext(ctx, s.clock, wait); err != nil {
+			return errors.Wrap(err, "wiz.SlidingWindow.Wait")
+		}
+	}
+}
+
+// Creates a KeyedLimiter that calls newLimiter for each new key, and forgets keys not used for idle (10 minutes if not positive)
+func NewKeyedLimiter(newLimiter func() Limiter, idle time.Duration, clock Clock) *KeyedLimiter {
+	if clock == nil {
+		clock = currentClock()
+	}
+	if idle <= 0 {
+		idle = defaultKeyedLimiterIdle
+	}
+	return &KeyedLimiter{clock: clock, newLimiter: newLimiter, idle: idle, limiters: map[string]*keyedLimiterEntry{}, lastSweep: clock.Now()}
+}
+
+// Returns the limiter for a key, creating it if needed
+func (k *KeyedLimiter) Get(key string) Limiter {
+	return k.entry(key, 0).limiter
+}
+
+// Allow on the limiter for a key
+func (k *KeyedLimiter) Allow(key string) bool {
+	return k.Get(key).Allow()
+}
+
+// Wait on the limiter for a key, which is kept until the wait is over
+func (k *KeyedLimiter) Wait(ctx context.Context, key string) error {
+	entry := k.entry(key, 1)
+	defer k.entry(key, -1)
+	return entry.limiter.Wait(ctx)
+}
+
+// Returns the number of keys currently remembered
+func (k *KeyedLimiter) Len() int {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return len(k.limiters)
+}
+
+//
+//
+//
+//
+//
+
+const defaultKeyedLimiterIdle = 10 * time.Minute
+
+type keyedLimiterEntry struct {
+	limiter  Limiter
+	lastUsed time.Time
+	waiting  int //Calls to Wait in progress
+}
+
+// Returns the entry for a key, creating it if needed, after forgetting idle keys. Adds waiting to its count of waiters.
+func (k *KeyedLimiter) entry(key string, waiting int) *keyedLimiterEntry {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	now := k.clock.Now()
+	if now.Sub(k.lastSweep) >= k.idle {
+		for other, entry := range k.limiters {
+			if entry.waiting == 0 && now.Sub(entry.lastUsed) >= k.idle {
+				delete(k.limiters, other)
+			}
+		}
+		k.lastSweep = now
+	}
+	entry, ok := k.limiters[key]
+	if !ok {
+		entry = &keyedLimiterEntry{limiter: k.newLimiter()}
+		k.limiters[key] = entry
+	}
+	entry.lastUsed = now
+	entry.waiting += waiting
+	return entry
+}
+
+// Caller holds lock
+func (b *TokenBucket) refill() {
+	now := b.clock.Now()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// Caller holds lock. Records a call if allowed, otherwise returns how long until one would be.
+func (s *SlidingWindow) try() (time.Duration, bool) {
+	now := s.clock.Now()
+	expired := 0
+	for expired < len(s.calls) && !s.calls[expired].After(now.Add(-s.window)) {
+		expired++
+	}
+	s.calls = s.calls[expired:]
+	if len(s.calls) < s.limit {
+		s.calls = append(s.calls, now)
+		return 0, true
+	}
+	if len(s.calls) == 0 {
+		return 0, false
+	}
+	return s.calls[0].Add(s.window).Sub(now), false
+}
+
+// Sleeps on a clock, returning early with ctx.Err() if ctx is done
+func sleepContext(ctx context.Context, clock Clock, d time.Duration) error {
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,210 @@
+package wiz
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"strconv"
+	"time"
+)
+
+//		Retrying operations that fail, with exponential backoff.
+
+//		The nth retry waits InitialDelay * Multiplier^(n-1), capped at MaxDelay,
+//			then jitter spreads retries out so that many clients failing at once
+//			don't all come back at once:
+//				NoJitter			the delay as computed
+//				FullJitter			random between 0 and the delay
+//				DecorrelatedJitter	random between InitialDelay and 3 times the
+//									previous delay, capped at MaxDelay (Multiplier
+//									is not used)
+//			Random numbers come from the current RandomSource.
+
+//		Retry stops when the operation succeeds, returns a Permanent error,
+//			MaxAttempts have been made, the next wait would pass MaxElapsed, or
+//			ctx is done. Zero MaxAttempts and MaxElapsed mean no limit.
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+//		Example:
+//		var body []byte
+//		err := Retry(ctx, DefaultRetryPolicy, func() error {
+//			var err error
+//			body, err = client.Get(url)
+//			return err
+//		})
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+// How a RetryPolicy randomises its delays
+type Jitter int
+
+const (
+	NoJitter Jitter = iota
+	FullJitter
+	DecorrelatedJitter
+)
+
+// When and how often Retry tries again. Policies hold no state, so one can be shared by any number of calls.
+type RetryPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration //Zero for no cap
+	Multiplier   float64       //Below 1 is treated as 1
+	Jitter       Jitter
+	MaxAttempts  int
+	MaxElapsed   time.Duration
+	OnAttempt    func(RetryAttempt) //Called after every failed attempt, e.g. for logging
+	Clock        Clock              //Nil for the current Clock
+}
+
+// Describes a failed attempt, for RetryPolicy.OnAttempt
+type RetryAttempt struct {
+	Number  int //From 1
+	Err     error
+	Elapsed time.Duration //Since Retry was called
+	Delay   time.Duration //Wait before the next attempt
+	Final   bool          //No more attempts will be made
+}
+
+// 5 attempts, starting at 100ms and doubling, with FullJitter
+var DefaultRetryPolicy = RetryPolicy{
+	InitialDelay: 100 * time.Millisecond,
+	MaxDelay:     30 * time.Second,
+	Multiplier:   2,
+	Jitter:       FullJitter,
+	MaxAttempts:  5,
+}
+
+// Calls op until it succeeds or the policy gives up (see top of Retry.go). Returns nil or the last error, wrapped.
+func Retry(ctx context.Context, policy RetryPolicy, op func() error) error {
+	clock := policy.Clock
+	if clock == nil {
+		clock = currentClock()
+	}
+	start := clock.Now()
+	previous := time.Duration(0)
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		permanent := IsPermanent(err)
+		delay := policy.delay(attempt, previous)
+		previous = delay
+		elapsed := clock.Now().Sub(start)
+		info := RetryAttempt{Number: attempt, Err: err, Elapsed: elapsed, Delay: delay}
+		reason := ""
+		switch {
+		case permanent:
+			reason = "permanent error"
+		case policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts:
+			reason = "gave up after " + strconv.Itoa(attempt) + " attempts"
+		case policy.MaxElapsed > 0 && elapsed+delay > policy.MaxElapsed:
+			reason = "gave up after " + elapsed.String()
+		case ctx.Err() != nil:
+			reason = ctx.Err().Error()
+		}
+		if reason != "" {
+			info.Delay, info.Final = 0, true
+		}
+		if policy.OnAttempt != nil {
+			policy.OnAttempt(info)
+		}
+		if reason != "" {
+			return errors.Wrap(err, "wiz.Retry: "+reason)
+		}
+		if sleepContext(ctx, clock, delay) != nil {
+			return errors.Wrap(err, "wiz.Retry: "+ctx.Err().Error())
+		}
+	}
+}
+
+// Marks an error as permanent, so Retry returns it without trying again
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// Returns true if err, or any error it wraps, was marked with Permanent
+func IsPermanent(err error) bool {
+	for err != nil {
+		if _, ok := err.(*permanentError); ok {
+			return true
+		}
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+//
+//
+//
+//
+//
+
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string { return p.err.Error() }
+func (p *permanentError) Cause() error  { return p.err }
+func (p *permanentError) Unwrap() error { return p.err }
+
+// Delay before attempt n+1, given the delay before attempt n
+func (p RetryPolicy) delay(n int, previous time.Duration) time.Duration {
+	ceiling := time.Duration(1<<63 - 1)
+	if p.MaxDelay > 0 {
+		ceiling = p.MaxDelay
+	}
+	if p.Jitter == DecorrelatedJitter {
+		if previous < p.InitialDelay {
+			previous = p.InitialDelay
+		}
+		high := ceiling
+		if previous < ceiling/3 {
+			high = previous * 3
+		}
+		if high <= p.InitialDelay {
+			return high
+		}
+		return p.InitialDelay + randomDuration(high-p.InitialDelay)
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(p.InitialDelay)
+	for i := 1; i < n && d < float64(ceiling); i++ {
+		d *= multiplier
+	}
+	delay := ceiling
+	if d < float64(ceiling) {
+		delay = time.Duration(d)
+	}
+	if p.Jitter == FullJitter {
+		return randomDuration(delay)
+	}
+	return delay
+}
+
+// Uniform in [0, max]. Falls back to max if randomness fails.
+func randomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	n, err := randomUint64n(currentRandomSource(), uint64(max))
+	if err != nil {
+		return max
+	}
+	return time.Duration(n)
+}
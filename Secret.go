@@ -0,0 +1,163 @@
+package wiz
+
+import (
+	"crypto/subtle"
+	"fmt"
+)
+
+//		Passwords, keys and tokens that can't end up in logs by accident.
+
+//		Secret (text) and SecretBytes print as Redacted however they are
+//			printed: Print, the colour functions, fmt with any verb (%v, %+v,
+//			%#v, %s, %q, %x ...), String, StringWith, and JSON. The value is
+//			only available from Reveal, so every use of it is easy to find.
+
+//		Equal compares in constant time, so it is safe for checking tokens.
+//			An empty secret (including a wiped one) is never Equal to anything,
+//			not even another empty one, so a wiped token can't match empty input.
+//			Wipe overwrites the value with zeros when it is no longer needed.
+//			(A Secret made from a string can't wipe the original string, which
+//			Go never lets you change. SilentPromptSecret never makes one.)
+
+//		Copies of a Secret share its memory, so wiping one wipes them all: every
+//			copy is empty afterwards (Len 0, Reveal empty). Don't Wipe while
+//			another goroutine might be using a copy.
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+//		Example:
+//		password := SilentPromptSecret("Password:")
+//		defer password.Wipe()
+//		Print("got", password)		//got [REDACTED]
+//		ok, err := VerifyPassword(string(password.Reveal()), stored)
+
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+//		*	*	*	*	*	*	*	*	*	*	*	*	*	*	*	*
+
+// Secret bytes that print as Redacted. The zero value is empty.
+type SecretBytes struct {
+	value *secretValue //Shared by copies, so Wipe reaches them all
+}
+
+// Secret text that prints as Redacted. The zero value is empty.
+type Secret struct {
+	bytes SecretBytes
+}
+
+// Wraps b (without copying it, so Wipe clears b too)
+func NewSecretBytes(b []byte) SecretBytes {
+	return SecretBytes{&secretValue{b}}
+}
+
+// Wraps a copy of s
+func NewSecret(s string) Secret {
+	return Secret{NewSecretBytes([]byte(s))}
+}
+
+// Returns the secret itself (not a copy)
+func (s SecretBytes) Reveal() []byte {
+	return s.bytes()
+}
+
+// Compares two secrets in constant time (for a given length). False if either is empty.
+func (s SecretBytes) Equal(other SecretBytes) bool {
+	a, b := s.bytes(), other.bytes()
+	if len(a) == 0 || len(b) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// Returns the length of the secret
+func (s SecretBytes) Len() int {
+	return len(s.bytes())
+}
+
+// Overwrites the secret with zeros and empties it, and every copy of it
+func (s SecretBytes) Wipe() {
+	if s.value == nil {
+		return
+	}
+	for i := range s.value.b {
+		s.value.b[i] = 0
+	}
+	s.value.b = nil
+}
+
+// Returns Redacted
+func (s SecretBytes) String() string {
+	return Redacted
+}
+
+// Returns Redacted
+func (s SecretBytes) GoString() string {
+	return Redacted
+}
+
+// Prints Redacted, for any verb
+func (s SecretBytes) Format(f fmt.State, verb rune) {
+	f.Write([]byte(Redacted))
+}
+
+// Encodes Redacted as a JSON string
+func (s SecretBytes) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + Redacted + `"`), nil
+}
+
+// Returns the secret itself (as a new string, which Wipe can't clear)
+func (s Secret) Reveal() string {
+	return string(s.bytes.Reveal())
+}
+
+// Compares two secrets in constant time (for a given length). False if either is empty.
+func (s Secret) Equal(other Secret) bool {
+	return s.bytes.Equal(other.bytes)
+}
+
+// Returns the length of the secret in bytes
+func (s Secret) Len() int {
+	return s.bytes.Len()
+}
+
+// Overwrites the secret with zeros and empties it, and every copy of it
+func (s Secret) Wipe() {
+	s.bytes.Wipe()
+}
+
+// Returns Redacted
+func (s Secret) String() string {
+	return Redacted
+}
+
+// Returns Redacted
+func (s Secret) GoString() string {
+	return Redacted
+}
+
+// Prints Redacted, for any verb
+func (s Secret) Format(f fmt.State, verb rune) {
+	f.Write([]byte(Redacted))
+}
+
+// Encodes Redacted as a JSON string
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return s.bytes.MarshalJSON()
+}
+
+//
+//
+//
+//
+//
+
+type secretValue struct {
+	b []byte
+}
+
+func (s SecretBytes) bytes() []byte {
+	if s.value == nil {
+		return nil
+	}
+	return s.value.b
+}
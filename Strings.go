@@ -1,10 +1,18 @@
 package wiz
 
 import (
+	"bytes"
+	"encoding"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // Converts string to lowercase
@@ -51,3 +59,341 @@ func String(input interface{}) string {
 	//If not, just string the data type
 	return reflect.TypeOf(input).String()
 }
+
+// Options for StringWith. With the zero value, output is the same as String's for most values, except that:
+//   - there is no newline at the end
+//   - byte arrays inside other values are base64 like byte slices (String lists their numbers)
+//   - channels and functions inside other values are shown as "<chan int>" (String gives up on the whole value and returns its type)
+//   - NaN and infinities are shown as strings (String gives up on the whole value)
+//   - pointer cycles are shown as "<cycle>" (String gives up on the whole value)
+//   - fields are redacted, and a top-level fmt.Stringer isn't used if its type has fields to redact
+type StringOptions struct {
+	HexBytes     bool     //Byte slices and arrays as hex rather than base64
+	MaxDepth     int      //Levels of nesting to show; deeper structs, maps and slices become "..." (0 for no limit)
+	MaxLength    int      //Longest result in bytes; longer results are cut and end in "..." if there is room (0 for no limit)
+	RedactFields []string //Field names to redact (ignoring case), as well as fields tagged `wiz:"secret"`
+}
+
+// Replaces redacted values in StringWith
+const Redacted = "[REDACTED]"
+
+// Like String, but safe for logs: struct fields tagged `wiz:"secret"` are replaced with Redacted, pointer cycles are shown as "<cycle>", and map keys are sorted. Output is compact JSON, as far as it can be (see StringOptions for differences from String).
+func StringWith(input interface{}, options StringOptions) string {
+	r := &stringRenderer{options: options, path: map[stringVisit]bool{}}
+	t := reflect.TypeOf(input)
+	s := ""
+	stringer, isStringer := input.(fmt.Stringer)
+	text, isString := input.(string)
+	switch {
+	case isStringer && !r.hasRedactedFields(t, map[reflect.Type]bool{}):
+		s = stringer.String()
+	case isString:
+		s = text
+	case t != nil && byteSequence(t) && !t.Implements(jsonMarshalerType):
+		s = r.bytes(reflect.ValueOf(input)) //Not quoted at the top level, as in String
+	case t != nil && unrenderable(t.Kind()):
+		s = t.String() //As String does when JSON fails
+	default:
+		r.render(reflect.ValueOf(input), 0)
+		s = r.buf.String()
+	}
+	if options.MaxLength > 0 && len(s) > options.MaxLength {
+		ellipsis := "..."
+		if options.MaxLength < len(ellipsis) {
+			ellipsis = "" //No room for it, so just cut
+		}
+		cut := options.MaxLength - len(ellipsis)
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut] + ellipsis
+	}
+	return s
+}
+
+//
+//
+//
+//
+//
+
+type stringVisit struct {
+	ptr uintptr
+	t   reflect.Type
+}
+
+type stringRenderer struct {
+	options StringOptions
+	buf     bytes.Buffer
+	path    map[stringVisit]bool //Pointers, maps and slices being rendered, for finding cycles
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+func byteSequence(t reflect.Type) bool {
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Uint8
+}
+
+// Encodes a byte slice or array as base64 or hex
+func (r *stringRenderer) bytes(v reflect.Value) string {
+	b := make([]byte, v.Len())
+	for i := range b {
+		b[i] = byte(v.Index(i).Uint())
+	}
+	if r.options.HexBytes {
+		return hex.EncodeToString(b)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// Quotes a string as JSON does, without escaping HTML characters
+func quoteJSON(s string) string {
+	b := new(bytes.Buffer)
+	e := json.NewEncoder(b)
+	e.SetEscapeHTML(false)
+	e.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (r *stringRenderer) render(v reflect.Value, depth int) {
+	if !v.IsValid() {
+		r.buf.WriteString("null")
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			r.buf.WriteString("null")
+			return
+		}
+	}
+	if r.marshaler(v) {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		visit := stringVisit{v.Pointer(), v.Type()}
+		if r.path[visit] {
+			r.buf.WriteString(`"<cycle>"`)
+			return
+		}
+		r.path[visit] = true
+		defer delete(r.path, visit)
+	}
+	if byteSequence(v.Type()) {
+		r.buf.WriteString(`"` + r.bytes(v) + `"`)
+		return
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		if r.options.MaxDepth > 0 && depth >= r.options.MaxDepth {
+			r.buf.WriteString(`"..."`)
+			return
+		}
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		r.render(v.Elem(), depth)
+	case reflect.String:
+		r.buf.WriteString(quoteJSON(v.String()))
+	case reflect.Bool:
+		r.buf.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		r.buf.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		r.buf.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case math.IsNaN(f) || math.IsInf(f, 0):
+			r.buf.WriteString(`"` + strconv.FormatFloat(f, 'g', -1, 64) + `"`)
+		case f != 0 && (math.Abs(f) < 1e-6 || math.Abs(f) >= 1e21):
+			e := strconv.FormatFloat(f, 'e', -1, v.Type().Bits())
+			if n := len(e); n >= 4 && e[n-4:n-1] == "e-0" {
+				e = e[:n-2] + e[n-1:] //1e-07 is 1e-7, as encoding/json writes it
+			}
+			r.buf.WriteString(e)
+		default:
+			r.buf.WriteString(strconv.FormatFloat(f, 'f', -1, v.Type().Bits()))
+		}
+	case reflect.Slice, reflect.Array:
+		r.buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				r.buf.WriteByte(',')
+			}
+			r.render(v.Index(i), depth+1)
+		}
+		r.buf.WriteByte(']')
+	case reflect.Map:
+		keys := v.MapKeys()
+		names := make([]string, len(keys))
+		order := make([]int, len(keys))
+		for i, k := range keys {
+			names[i], order[i] = mapKeyString(k), i
+		}
+		sort.Slice(order, func(i, j int) bool { return names[order[i]] < names[order[j]] })
+		r.buf.WriteByte('{')
+		for n, i := range order {
+			if n > 0 {
+				r.buf.WriteByte(',')
+			}
+			r.buf.WriteString(quoteJSON(names[i]) + ":")
+			r.render(v.MapIndex(keys[i]), depth+1)
+		}
+		r.buf.WriteByte('}')
+	case reflect.Struct:
+		r.buf.WriteByte('{')
+		r.fields(v, depth, false)
+		r.buf.WriteByte('}')
+	default:
+		r.buf.WriteString(quoteJSON("<" + v.Type().String() + ">")) //Channels, functions, complex numbers
+	}
+}
+
+// Writes a struct's fields, following encoding/json's tags. Embedded structs are written inline. Returns whether anything was written.
+func (r *stringRenderer) fields(v reflect.Value, depth int, written bool) bool {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, fv := t.Field(i), v.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "-" && len(tag) == 1 {
+			continue
+		}
+		name := tag[0]
+		if field.Anonymous && name == "" {
+			inner := fv
+			if inner.Kind() == reflect.Ptr {
+				if inner.IsNil() {
+					continue
+				}
+				inner = inner.Elem()
+			}
+			if inner.Kind() == reflect.Struct {
+				written = r.fields(inner, depth, written)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue //Unexported
+		}
+		if name == "" {
+			name = field.Name
+		}
+		omitEmpty := false
+		for _, option := range tag[1:] {
+			omitEmpty = omitEmpty || option == "omitempty"
+		}
+		if omitEmpty && emptyValue(fv) {
+			continue
+		}
+		if written {
+			r.buf.WriteByte(',')
+		}
+		written = true
+		r.buf.WriteString(quoteJSON(name) + ":")
+		if r.redacted(field, name) {
+			r.buf.WriteString(quoteJSON(Redacted))
+			continue
+		}
+		r.render(fv, depth+1)
+	}
+	return written
+}
+
+// Kinds that encoding/json can't encode at all
+func unrenderable(k reflect.Kind) bool {
+	return k == reflect.Chan || k == reflect.Func || k == reflect.Complex64 || k == reflect.Complex128 || k == reflect.UnsafePointer
+}
+
+// True if t (or a struct it points to or embeds) has fields that StringWith would redact
+func (r *stringRenderer) hasRedactedFields(t reflect.Type, seen map[reflect.Type]bool) bool {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || seen[t] {
+		return false
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if r.redacted(field, field.Name) || r.hasRedactedFields(field.Type, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *stringRenderer) redacted(field reflect.StructField, name string) bool {
+	for _, option := range strings.Split(field.Tag.Get("wiz"), ",") {
+		if strings.TrimSpace(option) == "secret" {
+			return true
+		}
+	}
+	for _, f := range r.options.RedactFields {
+		if strings.EqualFold(f, field.Name) || strings.EqualFold(f, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Uses MarshalJSON or MarshalText if v has them, as encoding/json does. Returns whether it did.
+func (r *stringRenderer) marshaler(v reflect.Value) bool {
+	if !v.CanInterface() {
+		return false
+	}
+	if v.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(v.Type()).Implements(jsonMarshalerType) {
+		v = v.Addr()
+	}
+	if v.Type().Implements(jsonMarshalerType) {
+		b, err := v.Interface().(json.Marshaler).MarshalJSON()
+		if err == nil {
+			if c, err := CompactJSON(b); err == nil {
+				r.buf.Write(c)
+				return true
+			}
+		}
+		return false
+	}
+	if v.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(v.Type()).Implements(textMarshalerType) {
+		v = v.Addr()
+	}
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err == nil {
+			r.buf.WriteString(quoteJSON(string(b)))
+			return true
+		}
+	}
+	return false
+}
+
+func mapKeyString(k reflect.Value) string {
+	if m, ok := k.Interface().(encoding.TextMarshaler); ok && k.Kind() != reflect.String {
+		if b, err := m.MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(k.Interface())
+}
+
+// Values that encoding/json's omitempty leaves out
+func emptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -1,16 +1,142 @@
 package wiz
 
 import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
 	time "time"
 )
 
-// Now returns unix timestamp of now.
+//		Timestamps are uint64 unix times, in seconds unless the name says otherwise.
+//			All of them read the current Clock (see Clock.go). The On versions
+//			read a given Clock instead, which tests can use without SetClock.
+
+//		ParseTime tries each format below in order and reports which one matched:
+//			"unix"			digits only, below 100000000000 (seconds until year 5138)
+//			"unixmillis"	digits only, 100000000000 or more
+//			"RFC3339"		2006-01-02T15:04:05Z07:00 (fractional seconds allowed)
+//			"RFC1123"		Mon, 02 Jan 2006 15:04:05 MST
+//			"RFC1123Z"		Mon, 02 Jan 2006 15:04:05 -0700
+//			then the layouts in timeLayouts, reported as the layout itself
+//		Times without a zone (including date-only layouts) are read as UTC.
+
+// Now returns unix timestamp of now (according to the current Clock).
 func Now() uint64 {
-	utc := time.Now()         //gets time from system
+	return NowOn(currentClock()) //gets time from system, unless the clock was swapped
+}
+
+// Returns unix timestamp of now according to a given Clock
+func NowOn(c Clock) uint64 {
+	utc := c.Now()
 	return uint64(utc.Unix()) //Converts unix time from int64 to uint64
 }
 
-// Sleep sleeps for n seconds(int)
+// Returns unix timestamp of now in milliseconds
+func NowMillis() uint64 {
+	return NowMillisOn(currentClock())
+}
+
+// Returns unix timestamp of now in milliseconds according to a given Clock
+func NowMillisOn(c Clock) uint64 {
+	return TimeToUnixMillis(c.Now())
+}
+
+// Returns unix timestamp of now in nanoseconds
+func NowNanos() uint64 {
+	return NowNanosOn(currentClock())
+}
+
+// Returns unix timestamp of now in nanoseconds according to a given Clock
+func NowNanosOn(c Clock) uint64 {
+	return uint64(c.Now().UnixNano())
+}
+
+// Sleep sleeps for n seconds(int) (according to the current Clock)
 func Sleep(seconds int) {
-	time.Sleep(time.Duration(seconds) * time.Second)
+	SleepOn(currentClock(), seconds)
+}
+
+// Sleeps for n seconds according to a given Clock
+func SleepOn(c Clock, seconds int) {
+	c.Sleep(time.Duration(seconds) * time.Second)
+}
+
+// Converts a unix timestamp in seconds to a time.Time (in UTC)
+func UnixToTime(seconds uint64) time.Time {
+	return time.Unix(int64(seconds), 0).UTC()
+}
+
+// Converts a unix timestamp in milliseconds to a time.Time (in UTC)
+func UnixMillisToTime(millis uint64) time.Time {
+	return time.Unix(int64(millis/1000), int64(millis%1000)*int64(time.Millisecond)).UTC()
+}
+
+// Converts a time.Time to a unix timestamp in seconds. Times before 1970 give 0.
+func TimeToUnix(t time.Time) uint64 {
+	if t.Unix() < 0 {
+		return 0
+	}
+	return uint64(t.Unix())
+}
+
+// Converts a time.Time to a unix timestamp in milliseconds. Times before 1970 give 0.
+func TimeToUnixMillis(t time.Time) uint64 {
+	if t.Unix() < 0 {
+		return 0
+	}
+	return uint64(t.Unix())*1000 + uint64(t.Nanosecond())/uint64(time.Millisecond)
+}
+
+// Parses a time in any of the formats listed at the top of Time.go. Also returns the name of the format that matched.
+func ParseTime(s string) (time.Time, string, error) {
+	s = strings.TrimSpace(s)
+	if s != "" && strings.Trim(s, "0123456789") == "" {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return time.Time{}, "", errors.Wrap(err, "wiz.ParseTime")
+		}
+		if n < unixMillisThreshold {
+			return UnixToTime(n), "unix", nil
+		}
+		return UnixMillisToTime(n), "unixmillis", nil
+	}
+	for _, f := range namedTimeFormats {
+		if t, err := time.Parse(f.layout, s); err == nil {
+			return t, f.name, nil
+		}
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, layout, nil
+		}
+	}
+	return time.Time{}, "", errors.New("wiz.ParseTime: unrecognised time format " + strconv.Quote(s))
+}
+
+//
+//
+//
+//
+//
+
+// Digit strings at least this large are read as milliseconds
+const unixMillisThreshold = 100000000000
+
+var namedTimeFormats = []struct{ name, layout string }{
+	{"RFC3339", time.RFC3339},
+	{"RFC1123", time.RFC1123},
+	{"RFC1123Z", time.RFC1123Z},
+}
+
+// Layouts tried after the named formats, most specific first
+var timeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+	"02 Jan 2006",
+	"2 January 2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
 }
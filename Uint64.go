@@ -3,28 +3,44 @@ package wiz
 import (
 	"github.com/pkg/errors"
 	"reflect"
-	"strconv"
 )
 
-// Converts certain number types and strings to uint64.
-// Returns an error on failed conversion explaining why.
+// Converts numbers, bools and strings to uint64 (see top of Convert.go).
+// Returns a *ConversionError on failed conversion explaining why.
 func Uint64(input interface{}) (uint64, error) {
-	n := uint64(0)
-	err := error(nil)
-	switch v := reflect.ValueOf(input); v.Kind() {
-	case reflect.String:
-		n, err = strconv.ParseUint(input.(string), 10, 64)
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		i := v.Int()
-		if i < 0 {
-			err = errors.New("Uint64: negative input")
-		} else {
-			n = uint64(i)
+	fail := func(err error) (uint64, error) { return 0, &ConversionError{"Uint64", input, err} }
+	n, err := toNumeric(input)
+	if err != nil {
+		return fail(err)
+	}
+	if n.isFloat {
+		if err := checkIntegral(n.f); err != nil {
+			return fail(err)
+		}
+		if n.f < 0 || n.f >= 1<<64 {
+			return fail(ErrConversionRange)
+		}
+		return uint64(n.f), nil
+	}
+	if n.neg && n.mag != 0 {
+		return fail(ErrConversionRange)
+	}
+	return n.mag, nil
+}
+
+// Options for Uint64With and Float64With
+type ConvertOptions struct {
+	ByteSizes bool //Also accept strings such as "10MiB" (see ParseBytes)
+	NonFinite bool //Float64With only: accept "NaN", "Inf" and non-finite floats
+}
+
+// Uint64, with options
+func Uint64With(input interface{}, opts ConvertOptions) (uint64, error) {
+	n, err := Uint64(input)
+	if err != nil && opts.ByteSizes && errors.Cause(err) == ErrConversionSyntax {
+		if size, sizeErr := ParseBytes(reflect.ValueOf(input).String()); sizeErr == nil {
+			return size, nil
 		}
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		n = v.Uint()
-	default:
-		err = errors.New("Uint64: cannot handle type " + reflect.TypeOf(input).String())
 	}
 	return n, err
 }
@@ -1,7 +1,18 @@
 package wiz
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestAll(t *testing.T) {
@@ -11,3 +22,1365 @@ func TestAll(t *testing.T) {
 	Green("ProgramName", ProgramName())
 	defer Purple(". . . Tested")
 }
+
+func TestMAC(t *testing.T) {
+	//NIST SP 800-185 KMAC256 sample #4
+	key, _ := HexToBytes("404142434445464748494A4B4C4D4E4F505152535455565758595A5B5C5D5E5F")
+	expected, _ := HexToBytes("20C570C31346F703C9AC36C61C03CB64C3970D0CFC787E9B79599D273A68D2F7F69D4CC3DE9D104A351689F27CF6F5951F0103F33F4F24871024D9C27773A8DD")
+	mac := KMAC([]byte{0, 1, 2, 3}, key, []byte("My Tagged Application"))
+	if !MACVerify(mac, expected) {
+		t.Error("KMAC256 sample mismatch", BytesToHex(mac))
+	}
+	h := HMAC([]byte("data"), key)
+	if !MACVerify(h, HMAC([]byte("data"), key)) || MACVerify(h, HMAC([]byte("datA"), key)) {
+		t.Error("HMAC verification failed")
+	}
+	if !HashMatch([]byte("data"), Hash([]byte("data"))) || HashMatch([]byte("data"), h[:63]) {
+		t.Error("HashMatch failed")
+	}
+}
+
+func TestBlobStore(t *testing.T) {
+	s, err := NewBlobStore("test_blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(Dir() + "test_blobs")
+	a, err := s.Put([]byte("alpha"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.PutReader(strings.NewReader("beta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b != BytesToHex(Hash([]byte("beta"))) || !s.Has(Lowercase(a)) {
+		t.Error("digest mismatch")
+	}
+	data, err := s.Get(a)
+	if err != nil || string(data) != "alpha" {
+		t.Error("Get failed", err)
+	}
+	WriteFile("test_blobs/"+b[0:2]+"/"+b[2:4]+"/"+b, []byte("tampered"))
+	if _, err = s.Get(b); err == nil {
+		t.Error("Get should detect tampering")
+	}
+	deleted, err := s.GC([]string{a})
+	if err != nil || len(deleted) != 1 || deleted[0] != b {
+		t.Error("GC failed", deleted, err)
+	}
+	list, _ := s.List()
+	if len(list) != 1 || list[0] != a {
+		t.Error("List failed", list)
+	}
+}
+
+func TestPassword(t *testing.T) {
+	cheap := PasswordParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	stored, err := HashPasswordWith("hunter2", cheap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Error("unexpected format", stored)
+	}
+	if ok, err := VerifyPassword("hunter2", stored); !ok || err != nil {
+		t.Error("correct password rejected", err)
+	}
+	if ok, _ := VerifyPassword("hunter3", stored); ok {
+		t.Error("wrong password accepted")
+	}
+	if NeedsRehash(stored, cheap) || !NeedsRehash(stored, DefaultPasswordParams) {
+		t.Error("NeedsRehash wrong")
+	}
+	if _, err := VerifyPassword("hunter2", "$argon2id$v=19$m=64"); err == nil {
+		t.Error("malformed hash accepted")
+	}
+	//Crafted costs must be refused before any hashing (these would need terabytes, or run for hours)
+	tail := stored[strings.LastIndex(stored[:strings.LastIndex(stored, "$")], "$"):]
+	for _, costs := range []string{"m=4294967295,t=1,p=1", "m=64,t=4294967295,p=1", "m=64,t=1,p=1,m=64"} {
+		if ok, err := VerifyPassword("hunter2", "$argon2id$v=19$"+costs+tail); ok || err == nil {
+			t.Error("accepted costs", costs)
+		}
+	}
+	if _, err := HashPasswordWith("x", PasswordParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 1 << 20}); err == nil {
+		t.Error("accepted huge KeyLength")
+	}
+}
+
+func TestLedger(t *testing.T) {
+	defer os.RemoveAll(Dir() + "test_ledger")
+	seed, _ := RandomBytes(32)
+	pub, pri, _ := NewEdKeyPair(seed)
+	l, err := OpenLedger("test_ledger", pub, pri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"one", "two", "three"} {
+		if _, err = l.Append([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = l.Verify(); err != nil {
+		t.Error(err)
+	}
+	status, body := l.Getter()(SplitURL("/blocks/2"))
+	if status != 200 || !strings.Contains(string(body), `"Number":2`) {
+		t.Error("Getter failed", status, string(body))
+	}
+	//Reopen, then tamper with block 2
+	l, err = OpenLedger("test_ledger", pub, pri)
+	if err != nil || l.Latest() != 3 {
+		t.Fatal("reopen failed", err)
+	}
+	b, _ := l.Block(2)
+	b.Data = []byte("TWO")
+	j, _ := Marshal(b)
+	WriteFile("test_ledger/2.json", j)
+	if err = l.Verify(); err == nil {
+		t.Error("tampering not detected")
+	}
+	DeleteFile("test_ledger/2.json")
+	if _, err = OpenLedger("test_ledger", nil, nil); err == nil {
+		t.Error("gap not detected")
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	//Results must not share Marshal's buffer, which the next call reuses
+	first, _ := Marshal("first")
+	Marshal("second, which is longer")
+	if string(first) != "\"first\"\n" {
+		t.Error("Marshal result overwritten", string(first))
+	}
+	//Concurrent calls take turns on the buffer (run with -race)
+	done := make(chan bool)
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			b, err := Marshal(map[string]int{"n": i})
+			done <- err == nil && string(b) == "{\"n\":"+fmt.Sprint(i)+"}\n"
+		}(i)
+	}
+	for i := 0; i < 8; i++ {
+		if !<-done {
+			t.Error("concurrent Marshal gave a wrong result")
+		}
+	}
+}
+
+func TestBackup(t *testing.T) {
+	defer os.RemoveAll(Dir() + "test_backup")
+	key, _ := RandomBytes(32)
+	big, _ := RandomBytes(200 * 1024)
+	os.MkdirAll(Dir()+"test_backup/src/sub", 0755)
+	WriteFile("test_backup/src/big", big)
+	WriteFile("test_backup/src/sub/small", []byte("small"))
+	b, err := OpenBackupStore("test_backup/store", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, err := b.Snapshot("test_backup/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Change one byte at the start of the big file; most chunks should be reused
+	big[0] ^= 1
+	WriteFile("test_backup/src/big", big)
+	s2, err := b.Snapshot("test_backup/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := 0
+	for i, c := range s2.Files[0].Chunks {
+		if i < len(s1.Files[0].Chunks) && c == s1.Files[0].Chunks[i] {
+			shared++
+		}
+	}
+	if shared < len(s2.Files[0].Chunks)-2 {
+		t.Error("expected chunks to be deduplicated", shared, len(s2.Files[0].Chunks))
+	}
+	if err = b.Verify(); err != nil {
+		t.Error(err)
+	}
+	if err = b.Restore(s1.ID, "test_backup/out"); err != nil {
+		t.Fatal(err)
+	}
+	restored, _ := ReadFile("test_backup/out/big")
+	small, _ := ReadFile("test_backup/out/sub/small")
+	big[0] ^= 1
+	if string(restored) != string(big) || string(small) != "small" {
+		t.Error("restore mismatch")
+	}
+	if _, err = restorePath(Dir()+"test_backup/out", "../escape"); err == nil {
+		t.Error("escaping path accepted")
+	}
+	//Directories are checked for symlinks out of the target too, before anything is created
+	os.MkdirAll(Dir()+"test_backup/src/sub/empty", 0755)
+	os.MkdirAll(Dir()+"test_backup/outside", 0755)
+	s3, err := b.Snapshot("test_backup/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(Dir() + "test_backup/out/sub")
+	os.Symlink(Dir()+"test_backup/outside", Dir()+"test_backup/out/sub")
+	if err = b.Restore(s3.ID, "test_backup/out"); err == nil {
+		t.Error("restored through a symlink")
+	}
+	if _, err = os.Stat(Dir() + "test_backup/outside/empty"); !os.IsNotExist(err) {
+		t.Error("directory created outside target", err)
+	}
+	//Deeper paths under the symlink must not have their parents created outside either
+	out := filepath.Join(Dir(), "test_backup/out")
+	if err = b.restoreFile(out, filepath.Join(out, "sub/evil/deep"), SnapshotFile{Path: "sub/evil/deep"}); err == nil {
+		t.Error("restored a file through a symlink")
+	}
+	if err = restoreDir(out, filepath.Join(out, "sub/evil2/deep"), SnapshotFile{Path: "sub/evil2/deep", Dir: true}); err == nil {
+		t.Error("restored a directory through a symlink")
+	}
+	for _, name := range []string{"evil", "evil2"} {
+		if _, err = os.Stat(Dir() + "test_backup/outside/" + name); !os.IsNotExist(err) {
+			t.Error("parent created outside target", name, err)
+		}
+	}
+	//A chunk that can't be checked for must fail the snapshot, not be assumed stored
+	digest := BytesToHex(Hash([]byte("fresh")))
+	blocker := Dir() + "test_backup/store/chunks/" + digest[0:2] + "/" + digest[2:4]
+	if _, err = os.Stat(blocker); os.IsNotExist(err) {
+		os.MkdirAll(Dir()+"test_backup/store/chunks/"+digest[0:2], 0755)
+		WriteFile("test_backup/store/chunks/"+digest[0:2]+"/"+digest[2:4], []byte("not a directory"))
+		WriteFile("test_backup/src/fresh", []byte("fresh"))
+		if _, err = b.Snapshot("test_backup/src"); err == nil {
+			t.Error("snapshot recorded a chunk it could not store")
+		}
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	if BytesToBase58([]byte("Hello World!")) != "2NEpo7TZRRrLZSi2U" {
+		t.Error("base58 mismatch")
+	}
+	hrp, data, err := Bech32mToBytes("A1LQFN3A")
+	if err != nil || hrp != "a" || len(data) != 0 {
+		t.Error("bech32m vector failed", err)
+	}
+	if _, _, err = Bech32ToBytes("A1LQFN3A"); err == nil || !strings.HasPrefix(err.Error(), "wiz.Bech32ToBytes: ") {
+		t.Error("bech32m accepted as bech32", err)
+	}
+	if _, _, err = Bech32mToBytes("a1LQFN3A"); err == nil || !strings.HasPrefix(err.Error(), "wiz.Bech32mToBytes: ") {
+		t.Error("mixed case accepted", err)
+	} else if _, ok := errors.Cause(err).(*DecodeError); !ok {
+		t.Error("mixed case error is not a *DecodeError", err)
+	}
+	payload, _ := RandomBytes(33)
+	payload[0] = 0
+	for _, name := range append(Codecs(), "bech32:npub", "bech32m:test") {
+		c, err := GetCodec(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := c.Decode(c.Encode(payload))
+		if err != nil || string(decoded) != string(payload) {
+			t.Error(name, "round trip failed", err)
+		}
+	}
+	bad := map[string]string{"base58": "3mJr0", "base64": "Zm9v!A==", "hex": "ABCX", "crockford": "01U2"}
+	offsets := map[string]int{"base58": 4, "base64": 4, "hex": 3, "crockford": 2}
+	for name, input := range bad {
+		c, _ := GetCodec(name)
+		_, err := c.Decode(input)
+		d, ok := errors.Cause(err).(*DecodeError)
+		if !ok || d.Offset != offsets[name] {
+			t.Error(name, "wrong error", err)
+		}
+	}
+	//Exported decoders name themselves in errors, like the rest of wiz
+	decoders := map[string]func(string) error{
+		"HexToBytes":         func(s string) error { _, err := HexToBytes(s); return err },
+		"Base32ToBytes":      func(s string) error { _, err := Base32ToBytes(s); return err },
+		"CrockfordToBytes":   func(s string) error { _, err := CrockfordToBytes(s); return err },
+		"Base58ToBytes":      func(s string) error { _, err := Base58ToBytes(s); return err },
+		"Base58CheckToBytes": func(s string) error { _, err := Base58CheckToBytes(s); return err },
+		"Base64ToBytes":      func(s string) error { _, err := Base64ToBytes(s); return err },
+		"Base64URLToBytes":   func(s string) error { _, err := Base64URLToBytes(s); return err },
+		"ParseUUID":          func(s string) error { _, err := ParseUUID(s); return err },
+		"ParseULID":          func(s string) error { _, err := ParseULID(s); return err },
+		"ParseHexDump":       func(s string) error { _, err := ParseHexDump(s); return err },
+	}
+	for name, decode := range decoders {
+		err := decode("AA!A")
+		d, ok := errors.Cause(err).(*DecodeError)
+		if !ok || !strings.HasPrefix(err.Error(), "wiz."+name+": ") || name != "ParseULID" && d.Offset != 2 {
+			t.Error(name, "wrong error", err)
+		}
+	}
+	if _, err := Base58CheckToBytes("11"); err == nil || err.Error() != "wiz.Base58CheckToBytes: wiz: invalid base58check input at offset 2: too short for checksum" {
+		t.Error("Base58CheckToBytes error", err)
+	}
+}
+
+func TestHexDump(t *testing.T) {
+	data := []byte("Hello, world!\n\x00\x01\x02\x03  |cafe|")
+	for _, opts := range []HexDumpOptions{DefaultHexDumpOptions, {Width: 8, Group: 1, Offsets: true, ASCII: true, Color: true}, {Width: 5}} {
+		parsed, err := ParseHexDump(HexDumpWith(data, opts))
+		if err != nil || string(parsed) != string(data) {
+			t.Error("round trip failed", opts, err)
+		}
+	}
+	//Every layout must read back, including gutters that look like hex or start with spaces
+	for _, sample := range [][]byte{data, []byte("Hello, world!"), []byte("  4865 6C6C  ab|"), {0x20, 0x20, 0x41}} {
+		for _, group := range []int{1, 2, 3, 4, 8, 16} {
+			for _, offsets := range []bool{false, true} {
+				for _, ascii := range []bool{false, true} {
+					opts := HexDumpOptions{Width: 16, Group: group, Offsets: offsets, ASCII: ascii}
+					parsed, err := ParseHexDump(HexDumpWith(sample, opts))
+					if err != nil || string(parsed) != string(sample) {
+						t.Errorf("round trip failed for %q with %+v: %q %v", sample, opts, parsed, err)
+					}
+				}
+			}
+		}
+	}
+	xxd := "00000000: 4865 6c6c 6f0a                           Hello.\n"
+	canonical := "00000000  48 65 6c 6c 6f 0a                                 |Hello.|\n00000006\n"
+	loose := "0x48, 0x65,0X6C\n\t6c6F 0a"
+	for _, dump := range []string{xxd, canonical, loose} {
+		parsed, err := ParseHexDump(dump)
+		if err != nil || string(parsed) != "Hello\n" {
+			t.Error("parse failed", dump, string(parsed), err)
+		}
+	}
+	//hexdump -C and xxd -a skip repeated lines with '*', and hexdump -C ends with the length
+	zeros := "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+	hexdumpC := "00000000  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|\n" +
+		"*\n" +
+		"00000030  48 65 6c 6c 6f 0a                                 |Hello.|\n" +
+		"00000036\n"
+	xxdA := "00000000: 0000 0000 0000 0000 0000 0000 0000 0000  ................\n" +
+		"*\n" +
+		"00000030: 4865 6c6c 6f0a                           Hello.\n"
+	trailing := "00000000  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|\n" +
+		"*\n" +
+		"00000030\n"
+	for dump, want := range map[string]string{hexdumpC: zeros + zeros + zeros + "Hello\n", xxdA: zeros + zeros + zeros + "Hello\n", trailing: zeros + zeros + zeros} {
+		parsed, err := ParseHexDump(dump)
+		if err != nil || string(parsed) != want {
+			t.Errorf("parse failed for %q: %q %v", dump, parsed, err)
+		}
+	}
+	for _, bad := range []string{"48 65\n*\n48", "00000000: 4865\n*\n00000003: 6c6c\n", "00000000: 4865\n*\n"} {
+		if _, err := ParseHexDump(bad); err == nil {
+			t.Errorf("parsed %q", bad)
+		}
+	}
+	_, err := ParseHexDump("48 6G")
+	if d, ok := errors.Cause(err).(*DecodeError); !ok || d.Offset != 4 {
+		t.Error("wrong error", err)
+	}
+}
+
+// Chi-squared statistic of observed counts against a uniform distribution
+func chiSquared(counts map[interface{}]int, buckets int, total int) float64 {
+	expected := float64(total) / float64(buckets)
+	sum := 0.0
+	for _, c := range counts {
+		d := float64(c) - expected
+		sum += d * d / expected
+	}
+	//Buckets that never came up
+	sum += float64(buckets-len(counts)) * expected
+	return sum
+}
+
+func TestRandomUniformity(t *testing.T) {
+	//Critical values for p = 0.0001, so a correct implementation fails about once in 10000 runs
+	const trials = 60000
+	ints := map[interface{}]int{}
+	floats := map[interface{}]int{}
+	chars := map[interface{}]int{}
+	perms := map[interface{}]int{}
+	for i := 0; i < trials; i++ {
+		n, err := RandomInt(-3, 6)
+		if err != nil || n < -3 || n > 6 {
+			t.Fatal("RandomInt out of range", n, err)
+		}
+		ints[n]++
+		f, _ := RandomFloat()
+		if f < 0 || f >= 1 {
+			t.Fatal("RandomFloat out of range", f)
+		}
+		floats[int(f*10)]++
+		s, _ := RandomString(1, "aβc😀e")
+		chars[s]++
+		p := []int{1, 2, 3}
+		Shuffle(p)
+		perms[p[0]*100+p[1]*10+p[2]]++
+	}
+	if x := chiSquared(ints, 10, trials); x > 33.72 {
+		t.Error("RandomInt not uniform", x, ints)
+	}
+	if x := chiSquared(floats, 10, trials); x > 33.72 {
+		t.Error("RandomFloat not uniform", x, floats)
+	}
+	if x := chiSquared(chars, 5, trials); x > 23.51 {
+		t.Error("RandomString not uniform", x, chars)
+	}
+	if x := chiSquared(perms, 6, trials); x > 25.74 {
+		t.Error("Shuffle not uniform", x, perms)
+	}
+	c, err := RandomChoice([]string{"only"})
+	if err != nil || c.(string) != "only" {
+		t.Error("RandomChoice failed", err)
+	}
+	if _, err = RandomInt(2, 1); err == nil {
+		t.Error("RandomInt accepted min > max")
+	}
+}
+
+func TestSeededSource(t *testing.T) {
+	//A Random with its own source is reproducible without swapping the global one
+	draw := func() string {
+		r := Random{NewSeededSource([]byte("seed"))}
+		bytes, _ := r.Bytes(4)
+		n, _ := r.Int(0, 1000000)
+		str, _ := r.String(8, "abcdefgh")
+		choice, _ := r.Choice([]int{1, 2, 3, 4, 5})
+		slice := []int{1, 2, 3, 4, 5, 6}
+		r.Shuffle(slice)
+		f, _ := r.Float()
+		return fmt.Sprint(bytes, n, str, choice, slice, f)
+	}
+	if a, b := draw(), draw(); a != b {
+		t.Fatal("seeded source not reproducible", a, b)
+	}
+	swappedDraw := func() int {
+		defer SetRandomSource(NewSeededSource([]byte("seed")))()
+		n, _ := Random{}.Int(0, 1000000) //nil Source means the current one
+		return n
+	}
+	if a, b := swappedDraw(), swappedDraw(); a != b {
+		t.Fatal("swapped source not reproducible", a, b)
+	}
+	if _, err := RandomInt(2, 1); err == nil || err.Error() != "wiz.RandomInt: min is greater than max" {
+		t.Error("RandomInt error", err)
+	}
+	if _, err := (Random{CryptoSource()}).Int(2, 1); err == nil || err.Error() != "wiz.Random.Int: min is greater than max" {
+		t.Error("Random.Int error", err)
+	}
+	//Stream must not depend on how reads are split
+	whole := make([]byte, 100)
+	NewSeededSource([]byte("x")).Read(whole)
+	parts := NewSeededSource([]byte("x"))
+	first, second := make([]byte, 37), make([]byte, 63)
+	parts.Read(first)
+	parts.Read(second)
+	if string(whole) != string(append(first, second...)) {
+		t.Error("seeded stream depends on read sizes")
+	}
+	//The swap is process-wide: other goroutines see it, unless they pass a source explicitly
+	expected := make([]byte, 16)
+	NewSeededSource([]byte("leak")).Read(expected)
+	restore := SetRandomSource(NewSeededSource([]byte("leak")))
+	seen := make(chan []byte)
+	go func() {
+		b, _ := RandomBytes(16)
+		seen <- b
+	}()
+	if b := <-seen; string(b) != string(expected) {
+		t.Error("other goroutines did not see the swapped source")
+	}
+	if b, _ := RandomBytesFrom(CryptoSource(), 16); string(b) == string(expected) {
+		t.Error("RandomBytesFrom used the swapped source")
+	}
+	//A second swap waits for the first to be restored
+	swapped := make(chan func())
+	go func() { swapped <- SetRandomSource(CryptoSource()) }()
+	select {
+	case <-swapped:
+		t.Error("second SetRandomSource did not wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	restore()
+	(<-swapped)()
+	if _, err := RandomBytesFrom(CryptoSource(), -1); err == nil {
+		t.Error("RandomBytesFrom accepted a negative length")
+	}
+}
+
+func TestIDs(t *testing.T) {
+	before := uint64(time.Now().UnixNano() / 1e6)
+	var lastUUID, lastULID string
+	var lastFlake uint64
+	flake, err := NewSnowflake(1288834974657, 5, 10, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5000; i++ {
+		u, _ := NewUUIDv7()
+		l, _ := NewULID()
+		f, _ := flake.Next()
+		if u.String() <= lastUUID || l.String() <= lastULID || f <= lastFlake {
+			t.Fatal("IDs not monotonic at", i)
+		}
+		lastUUID, lastULID, lastFlake = u.String(), l.String(), f
+	}
+	u, _ := ParseUUID(lastUUID)
+	ms, err := u.Timestamp()
+	if err != nil || ms < before || u.Version() != 7 {
+		t.Error("UUIDv7 timestamp wrong", ms, err)
+	}
+	l, err := ParseULID(Lowercase(lastULID))
+	if err != nil || l.String() != lastULID || l.Timestamp() < before {
+		t.Error("ULID parse failed", err)
+	}
+	if flake.Node(lastFlake) != 5 || flake.Timestamp(lastFlake) < before {
+		t.Error("Snowflake fields wrong")
+	}
+	v4, _ := NewUUIDv4()
+	parsed, err := ParseUUID("{" + Uppercase(v4.String()) + "}")
+	if err != nil || parsed != v4 || v4.Version() != 4 {
+		t.Error("UUIDv4 parse failed", err)
+	}
+	if _, err = ParseULID("81ARZ3NDEKTSV4RRFFQ69G5FAV"); err == nil {
+		t.Error("ULID overflow accepted")
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	defer SetClock(clock)()
+	done := make(chan uint64)
+	go func() {
+		Sleep(60)
+		done <- Now()
+	}()
+	ticker := clock.NewTicker(25 * time.Second)
+	clock.BlockUntil(2)
+	clock.Advance(59 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("woke early")
+	default:
+	}
+	if tick := <-ticker.C(); !tick.Equal(time.Unix(1025, 0)) { //1050 was dropped, as the channel was full
+		t.Error("ticker fired at wrong time", tick)
+	}
+	clock.Advance(time.Second)
+	if now := <-done; now != 1060 {
+		t.Error("woke at wrong time", now)
+	}
+	ticker.Stop()
+	if clock.Waiters() != 0 {
+		t.Error("waiters left over", clock.Waiters())
+	}
+	//A clock passed in only affects that call
+	other := NewFakeClock(time.Unix(5000, 0))
+	go func() {
+		SleepOn(other, 1)
+		done <- NowOn(other)
+	}()
+	other.BlockUntil(1)
+	other.Advance(time.Second)
+	if now := <-done; now != 5001 || Now() != 1060 {
+		t.Error("SleepOn", now, Now())
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	defer SetClock(NewFakeClock(time.Unix(1700000000, 123456789)))()
+	if NowMillis() != 1700000000123 || NowNanos() != 1700000000123456789 {
+		t.Error("sub-second Now", NowMillis(), NowNanos())
+	}
+	if clock := NewFakeClock(time.Unix(5, 6000000)); NowMillisOn(clock) != 5006 || NowNanosOn(clock) != 5006000000 {
+		t.Error("sub-second NowOn", NowMillisOn(clock), NowNanosOn(clock))
+	}
+	want := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	cases := map[string]string{
+		"1700000000":                      "unix",
+		"1700000000000":                   "unixmillis",
+		"2023-11-14T22:13:20Z":            "RFC3339",
+		"2023-11-15T00:13:20+02:00":       "RFC3339",
+		"Tue, 14 Nov 2023 22:13:20 UTC":   "RFC1123",
+		"Tue, 14 Nov 2023 17:13:20 -0500": "RFC1123Z",
+		"2023-11-14 22:13:20":             "2006-01-02 15:04:05",
+	}
+	for s, format := range cases {
+		got, f, err := ParseTime(s)
+		if err != nil || f != format || !got.Equal(want) {
+			t.Error("ParseTime", s, got, f, err)
+		}
+	}
+	if got, f, err := ParseTime("Nov 14, 2023"); err != nil || f != "Jan 2, 2006" || !got.Equal(time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Error("ParseTime date only", got, f, err)
+	}
+	if _, _, err := ParseTime("yesterday"); err == nil {
+		t.Error("ParseTime accepted garbage")
+	}
+	if TimeToUnixMillis(UnixMillisToTime(1700000000123)) != 1700000000123 || TimeToUnix(UnixToTime(42)) != 42 {
+		t.Error("unix conversions do not round trip")
+	}
+}
+
+func TestDuration(t *testing.T) {
+	parsed := map[string]time.Duration{
+		"1d12h": 36 * time.Hour,
+		"2w":    14 * 24 * time.Hour,
+		"1.5d":  36 * time.Hour,
+		"-90m":  -90 * time.Minute,
+		"1h30m": 90 * time.Minute,
+		"300ms": 300 * time.Millisecond,
+		".5s":   500 * time.Millisecond,
+		"0":     0,
+	}
+	for s, want := range parsed {
+		if d, err := ParseDuration(s); err != nil || d != want {
+			t.Error("ParseDuration", s, d, err)
+		}
+	}
+	for _, s := range []string{"", "1", "d", "1x", ".d", "99999999w"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Error("ParseDuration accepted", s)
+		}
+	}
+	d := 3*time.Hour + 12*time.Minute + 5*time.Second
+	if FormatDuration(d, 2) != "3h12m" || FormatDuration(d, 0) != "3h12m5s" || FormatDuration(-36*time.Hour, 0) != "-1d12h" {
+		t.Error("FormatDuration", FormatDuration(d, 2), FormatDuration(d, 0), FormatDuration(-36*time.Hour, 0))
+	}
+	if FormatDuration(24*time.Hour+5*time.Minute, 2) != "1d" || FormatDuration(1500*time.Microsecond, 0) != "1ms500us" {
+		t.Error("FormatDuration", FormatDuration(24*time.Hour+5*time.Minute, 2), FormatDuration(1500*time.Microsecond, 0))
+	}
+	now := time.Unix(1700000000, 0)
+	clock := NewFakeClock(now)
+	if AgoOn(clock, now.Add(-d)) != "3h12m ago" || AgoOn(clock, now.Add(d)) != "in 3h12m" || AgoOn(clock, now) != "just now" {
+		t.Error("AgoOn", AgoOn(clock, now.Add(-d)), AgoOn(clock, now.Add(d)), AgoOn(clock, now))
+	}
+	if UntilOn(clock, now.Add(d)) != "3h12m" || UntilOn(clock, now.Add(-d)) != "0s" {
+		t.Error("UntilOn", UntilOn(clock, now.Add(d)), UntilOn(clock, now.Add(-d)))
+	}
+	if Ago(time.Now().Add(-d)) != "3h12m ago" || Until(time.Now().Add(d+time.Second)) != "3h12m" {
+		t.Error("Ago/Until", Ago(time.Now().Add(-d)), Until(time.Now().Add(d+time.Second)))
+	}
+}
+
+func TestCron(t *testing.T) {
+	at := func(s string) time.Time {
+		parsed, _ := time.Parse("2006-01-02 15:04:05", s)
+		return parsed
+	}
+	cases := []struct{ expr, after, want string }{
+		{"*/15 9-17 * * MON-FRI", "2024-03-01 17:50:00", "2024-03-04 09:00:00"}, //Friday evening to Monday morning
+		{"0 0 13 * FRI", "2024-01-01 00:00:00", "2024-01-05 00:00:00"},          //Either day field matches
+		{"0 0 13 * *", "2024-01-01 00:00:00", "2024-01-13 00:00:00"},
+		{"30 */10 * * * *", "2024-01-01 00:00:30", "2024-01-01 00:10:30"},
+		{"0 0 29 2 *", "2023-03-01 00:00:00", "2024-02-29 00:00:00"},
+		{"@weekly", "2024-01-01 12:00:00", "2024-01-07 00:00:00"},
+		{"@every 1h30m", "2024-01-01 12:00:00", "2024-01-01 13:30:00"},
+		{"CRON_TZ=Asia/Tokyo 0 9 * * *", "2024-01-01 00:00:00", "2024-01-02 00:00:00"},
+	}
+	for _, c := range cases {
+		s, err := ParseCron(c.expr)
+		if err != nil {
+			t.Error("ParseCron", c.expr, err)
+			continue
+		}
+		if next := s.Next(at(c.after)); !next.Equal(at(c.want)) {
+			t.Error("Next", c.expr, next)
+		}
+	}
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "@every 1x"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Error("ParseCron accepted", expr)
+		}
+	}
+
+	clock := NewFakeClock(at("2024-01-01 00:00:00"))
+	errs := make(chan error, 1)
+	s := NewScheduler(SchedulerOptions{Clock: clock, Location: time.UTC, OnError: func(job string, err error) { errs <- err }})
+	runs := make(chan time.Time, 10)
+	s.Add("tick", "* * * * *", func() error {
+		runs <- clock.Now()
+		return nil
+	})
+	s.Add("boom", "0 0 * * * *", func() error { panic("boom") })
+	s.Start()
+	for i := 1; i <= 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		if run := <-runs; !run.Equal(at("2024-01-01 00:00:00").Add(time.Duration(i) * time.Minute)) {
+			t.Error("job ran at", run)
+		}
+	}
+	clock.BlockUntil(1)
+	clock.Set(at("2024-01-01 01:00:00"))
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Error("panic not recovered", err)
+	}
+	if next, ok := s.NextRun("boom"); !ok || !next.Equal(at("2024-01-01 02:00:00")) {
+		t.Error("NextRun", next, ok)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	delays := []time.Duration{}
+	policy := RetryPolicy{InitialDelay: time.Second, MaxDelay: 3 * time.Second, Multiplier: 2, MaxAttempts: 4, Clock: clock,
+		OnAttempt: func(a RetryAttempt) { delays = append(delays, a.Delay) }}
+	calls := 0
+	done := make(chan error)
+	go func() {
+		done <- Retry(context.Background(), policy, func() error {
+			calls++
+			return errors.New("flaky")
+		})
+	}()
+	for i := 0; i < 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(3 * time.Second)
+	}
+	err := <-done
+	if err == nil || calls != 4 || !strings.Contains(err.Error(), "gave up after 4 attempts") {
+		t.Error("Retry", calls, err)
+	}
+	if len(delays) != 4 || delays[0] != time.Second || delays[1] != 2*time.Second || delays[2] != 3*time.Second || delays[3] != 0 {
+		t.Error("Retry delays", delays)
+	}
+
+	calls = 0
+	err = Retry(context.Background(), policy, func() error {
+		calls++
+		return errors.Wrap(Permanent(errors.New("bad request")), "wrapped")
+	})
+	if calls != 1 || !IsPermanent(err) {
+		t.Error("Permanent", calls, err)
+	}
+
+	policy.Jitter, policy.MaxAttempts, policy.OnAttempt = FullJitter, 0, nil
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		clock.BlockUntil(1)
+		cancel()
+	}()
+	if err := Retry(ctx, policy, func() error { return errors.New("down") }); err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Error("Retry ignored cancellation", err)
+	}
+
+	defer SetRandomSource(NewSeededSource([]byte("retry")))()
+	for _, jitter := range []Jitter{FullJitter, DecorrelatedJitter} {
+		p := RetryPolicy{InitialDelay: time.Second, MaxDelay: 10 * time.Second, Multiplier: 2, Jitter: jitter}
+		previous := time.Duration(0)
+		for n := 1; n < 50; n++ {
+			d := p.delay(n, previous)
+			if d < 0 || d > 10*time.Second || (jitter == DecorrelatedJitter && d < time.Second) {
+				t.Error("jittered delay out of range", jitter, d)
+			}
+			previous = d
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	bucket := NewTokenBucket(2, 3, clock)
+	for i := 0; i < 3; i++ {
+		if !bucket.Allow() {
+			t.Error("burst refused at", i)
+		}
+	}
+	if bucket.Allow() {
+		t.Error("bucket allowed more than its burst")
+	}
+	done := make(chan error)
+	go func() { done <- bucket.Wait(context.Background()) }()
+	clock.BlockUntil(1)
+	clock.Advance(500 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	window := NewSlidingWindow(2, time.Minute, clock)
+	if !window.Allow() || !window.Allow() || window.Allow() {
+		t.Error("sliding window limit")
+	}
+	clock.Advance(59 * time.Second)
+	if window.Allow() {
+		t.Error("sliding window forgot too early")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- window.Wait(ctx) }()
+	clock.BlockUntil(1)
+	cancel()
+	if err := <-done; err == nil {
+		t.Error("Wait ignored cancellation")
+	}
+	clock.Advance(time.Second)
+	if !window.Allow() {
+		t.Error("sliding window did not slide")
+	}
+
+	keyed := NewKeyedLimiter(func() Limiter { return NewSlidingWindow(1, time.Minute, clock) }, time.Minute, clock)
+	if !keyed.Allow("a") || keyed.Allow("a") || !keyed.Allow("b") {
+		t.Error("keyed limiter")
+	}
+	clock.Advance(time.Minute)
+	keyed.Allow("c")
+	if keyed.Len() != 1 {
+		t.Error("idle keys not evicted", keyed.Len())
+	}
+	defaulted := NewKeyedLimiter(func() Limiter { return NewSlidingWindow(1, time.Minute, clock) }, 0, clock)
+	if !defaulted.Allow("a") || defaulted.Allow("a") {
+		t.Error("keyed limiter with idle 0 did not limit")
+	}
+	//A key with a Wait in progress is kept, however long it waits
+	slow := NewKeyedLimiter(func() Limiter { return NewSlidingWindow(1, time.Hour, clock) }, time.Minute, clock)
+	slow.Allow("w")
+	ctx, cancel = context.WithCancel(context.Background())
+	waited := make(chan error)
+	go func() { waited <- slow.Wait(ctx, "w") }()
+	clock.BlockUntil(1)
+	clock.Advance(2 * time.Minute)
+	slow.Allow("other")
+	if slow.Len() != 2 || slow.Allow("w") {
+		t.Error("key evicted while waiting", slow.Len())
+	}
+	cancel()
+	if err := <-waited; err == nil {
+		t.Error("Wait was not cancelled")
+	}
+	clock.Advance(2 * time.Minute)
+	slow.Allow("other")
+	if slow.Len() != 1 {
+		t.Error("key kept after waiting", slow.Len())
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	perIP := NewKeyedLimiter(func() Limiter { return NewSlidingWindow(1, time.Minute, clock) }, time.Minute, clock)
+	go ServeLimited(ln, perIP, func([]string) (int, []byte) { return 200, []byte("ok") }, nil)
+	client := NewClient(nil, 5)
+	client.SetLimiter(NewTokenBucket(100, 10, clock))
+	url := "http://" + ln.Addr().String() + "/"
+	if body, err := client.Get(url); err != nil || string(body) != "ok" {
+		t.Error("ServeLimited", string(body), err)
+	}
+	if _, err := client.Get(url); err == nil || !strings.Contains(err.Error(), "429") {
+		t.Error("ServeLimited did not limit", err)
+	}
+}
+
+func TestOTP(t *testing.T) {
+	//RFC 4226 appendix D and RFC 6238 appendix B
+	seed := "12345678901234567890"
+	secrets := map[string]string{
+		"SHA1":   BytesToBase32([]byte(seed)),
+		"SHA256": BytesToBase32([]byte(seed + seed[:12])),
+		"SHA512": BytesToBase32([]byte(seed + seed + seed + seed[:4])),
+	}
+	for i, want := range []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"} {
+		if code, err := HOTP(secrets["SHA1"], uint64(i), DefaultOTPOptions); err != nil || code != want {
+			t.Error("HOTP", i, code, err)
+		}
+	}
+	vectors := []struct {
+		time      int64
+		algorithm string
+		code      string
+	}{
+		{59, "SHA1", "94287082"}, {59, "SHA256", "46119246"}, {59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"}, {1111111109, "SHA256", "68084774"}, {1111111109, "SHA512", "25091201"},
+		{20000000000, "SHA1", "65353130"}, {20000000000, "SHA256", "77737706"}, {20000000000, "SHA512", "47863826"},
+	}
+	for _, v := range vectors {
+		opts := OTPOptions{Digits: 8, Algorithm: v.algorithm, Period: 30}
+		if code, err := TOTP(secrets[v.algorithm], time.Unix(v.time, 0), opts); err != nil || code != v.code {
+			t.Error("TOTP", v.time, v.algorithm, code, err)
+		}
+	}
+
+	secret, err := NewOTPSecret()
+	if err != nil || len(secret) != 32 {
+		t.Fatal("NewOTPSecret", secret, err)
+	}
+	now := time.Unix(1700000000, 0)
+	code, _ := TOTP(secret, now, DefaultOTPOptions)
+	if ok, err := VerifyTOTPAt(strings.ToLower(secret), code, now.Add(30*time.Second), DefaultOTPOptions); !ok || err != nil {
+		t.Error("VerifyTOTPAt rejected a code one period old", err)
+	}
+	if ok, _ := VerifyTOTPAt(secret, code, now.Add(60*time.Second), DefaultOTPOptions); ok {
+		t.Error("VerifyTOTPAt accepted a code two periods old")
+	}
+	code, _ = TOTP(secret, time.Now(), DefaultOTPOptions)
+	if ok, err := VerifyTOTP(secret, code, DefaultOTPOptions); !ok || err != nil {
+		t.Error("VerifyTOTP rejected a current code", err)
+	}
+	if _, err := VerifyTOTP(secret, code, OTPOptions{Digits: 6, Algorithm: "SHA1"}); err == nil || err.Error() != "wiz.VerifyTOTP: zero period" {
+		t.Error("VerifyTOTP error", err)
+	}
+	code, _ = HOTP(secret, 11, DefaultOTPOptions)
+	if next, ok, err := VerifyHOTP(secret, code, 10, DefaultOTPOptions); !ok || err != nil || next != 12 {
+		t.Error("VerifyHOTP", next, ok, err)
+	}
+	if _, err := HOTP("not base32!", 0, DefaultOTPOptions); err == nil {
+		t.Error("HOTP accepted a bad secret")
+	}
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "Acme Co", "alice@example.com", DefaultOTPOptions)
+	if uri != "otpauth://totp/Acme%20Co:alice%40example.com?secret=JBSWY3DPEHPK3PXP&issuer=Acme%20Co&algorithm=SHA1&digits=6&period=30" {
+		t.Error("TOTPURI", uri)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	uints := map[interface{}]uint64{"42": 42, " 1_000 ": 1000, "0x2A": 42, "0b101010": 42, "0o52": 42, "010": 10,
+		json.Number("7"): 7, 3.0: 3, "4.2e1": 42, true: 1, int8(5): 5, "18446744073709551615": 1<<64 - 1}
+	for in, want := range uints {
+		if n, err := Uint64(in); err != nil || n != want {
+			t.Error("Uint64", in, n, err)
+		}
+	}
+	failures := []struct {
+		in   interface{}
+		want error
+	}{{-1, ErrConversionRange}, {2.5, ErrConversionLossy}, {"1__0", ErrConversionSyntax}, {"18446744073709551616", ErrConversionRange},
+		{[]byte("1"), ErrConversionType}, {nil, ErrConversionType}, {"0x", ErrConversionSyntax}}
+	for _, f := range failures {
+		if _, err := Uint64(f.in); errors.Cause(err) != f.want {
+			t.Error("Uint64", f.in, err)
+		}
+	}
+	if n, err := Int64("-0x8000000000000000"); err != nil || n != -1<<63 {
+		t.Error("Int64", n, err)
+	}
+	if _, err := Int64(uint64(1 << 63)); errors.Cause(err) != ErrConversionRange {
+		t.Error("Int64 overflow", err)
+	}
+	if f, err := Float64("-2.5"); err != nil || f != -2.5 {
+		t.Error("Float64", f, err)
+	}
+	if _, err := Float64(int64(1<<53 + 1)); errors.Cause(err) != ErrConversionLossy {
+		t.Error("Float64 lossy", err)
+	}
+	for _, in := range []interface{}{"NaN", "-Inf", " +inf ", math.NaN(), math.Inf(1), float32(math.Inf(-1))} {
+		if _, err := Float64(in); errors.Cause(err) != ErrConversionRange {
+			t.Error("Float64 non-finite", in, err)
+		}
+		if f, err := Float64With(in, ConvertOptions{NonFinite: true}); err != nil || !(math.IsNaN(f) || math.IsInf(f, 0)) {
+			t.Error("Float64With NonFinite", in, f, err)
+		}
+	}
+	for in, want := range map[interface{}]bool{"Yes": true, "off": false, 1: true, "0": false, 0.0: false} {
+		if b, err := Bool(in); err != nil || b != want {
+			t.Error("Bool", in, b, err)
+		}
+	}
+	if _, err := Bool(2); err == nil || !strings.Contains(err.Error(), "wiz.Bool: converting int 2: out of range") {
+		t.Error("Bool", err)
+	}
+	durations := map[interface{}]time.Duration{"1d2h": 26 * time.Hour, "90": 90 * time.Second, 1.5: 1500 * time.Millisecond,
+		time.Minute: time.Minute, json.Number("-2"): -2 * time.Second}
+	for in, want := range durations {
+		if d, err := Duration(in); err != nil || d != want {
+			t.Error("Duration", in, d, err)
+		}
+	}
+	if _, err := Duration("soon"); errors.Cause(err) != ErrConversionSyntax {
+		t.Error("Duration", err)
+	}
+}
+
+func TestBind(t *testing.T) {
+	type Database struct {
+		Host string `bind:"host" default:"localhost"`
+		Port uint16 `bind:"port"`
+	}
+	type Common struct {
+		Verbose bool
+	}
+	type Config struct {
+		Common
+		Name    string        `bind:"name,required"`
+		Timeout time.Duration `bind:"timeout" default:"30s"`
+		Ratio   *float64      `bind:"ratio"`
+		Tags    []string      `bind:"tag"`
+		IDs     []int         `bind:"id"`
+		Since   time.Time     `bind:"since"`
+		DB      Database      `bind:"db"`
+		Skipped string        `bind:"-"`
+		hidden  string
+	}
+	c := Config{}
+	query, _ := url.ParseQuery("name=api&VERBOSE=yes&tag=a&tag=b&id=1,0x2,3&db.port=5432&since=2024-01-02T03:04:05Z&Skipped=x")
+	if err := Bind(query, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "api" || !c.Verbose || c.Timeout != 30*time.Second || c.Ratio != nil || len(c.Tags) != 2 || c.IDs[1] != 2 ||
+		c.DB.Host != "localhost" || c.DB.Port != 5432 || c.Since.Year() != 2024 || c.Skipped != "" {
+		t.Errorf("Bind %+v", c)
+	}
+	err := Bind(map[string]string{"db.port": "70000", "ratio": "abc", "timeout": "1m"}, &c)
+	bindErr, ok := err.(*BindError)
+	if !ok || len(bindErr.Fields) != 3 || c.Timeout != time.Minute || c.DB.Port != 5432 {
+		t.Error("Bind errors", err)
+	}
+	for _, field := range []string{"name: required", "ratio:", "db.port:"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Error("Bind error does not mention", field)
+		}
+	}
+	if Bind(map[string]string{}, c) == nil {
+		t.Error("Bind accepted a non-pointer")
+	}
+	for _, target := range []interface{}{nil, (*struct{})(nil), new(int)} {
+		if err := Bind(map[string]string{}, target); err == nil || !strings.HasPrefix(err.Error(), "wiz.Bind: ") {
+			t.Error("Bind accepted target", target, err)
+		}
+	}
+	if err := Bind(nil, &c); err == nil || !strings.HasPrefix(err.Error(), "wiz.Bind: ") {
+		t.Error("Bind accepted nil values", err)
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	sizes := map[string]uint64{"512": 512, "10MiB": 10 << 20, "1.5 GB": 1500000000, "10m": 10000000, "2 kib": 2048,
+		"1.1KiB": 1126, "16EiB": 0, ".5k": 500, "15.999999999999999999EiB": 18446744073709551614}
+	for s, want := range sizes {
+		n, err := ParseBytes(s)
+		if s == "16EiB" {
+			if errors.Cause(err) != ErrConversionRange {
+				t.Error("ParseBytes overflow", err)
+			}
+			continue
+		}
+		if err != nil || n != want {
+			t.Error("ParseBytes", s, n, err)
+		}
+	}
+	for _, s := range []string{"", "MB", "1.2.3KB", "10 XB", "-1KB"} {
+		if _, err := ParseBytes(s); errors.Cause(err) != ErrConversionSyntax {
+			t.Error("ParseBytes accepted", s, err)
+		}
+	}
+	formats := []struct {
+		n         uint64
+		units     ByteUnits
+		precision int
+		want      string
+	}{{1572864, IECUnits, 1, "1.5 MiB"}, {1572864, SIUnits, 2, "1.57 MB"}, {512, SIUnits, 2, "512 B"},
+		{1048575, IECUnits, 1, "1.0 MiB"}, {1<<64 - 1, IECUnits, 0, "16 EiB"}}
+	for _, f := range formats {
+		if got := FormatBytes(f.n, f.units, f.precision); got != f.want {
+			t.Error("FormatBytes", f.n, got)
+		}
+	}
+	if _, err := Uint64("10MiB"); err == nil {
+		t.Error("Uint64 accepted a byte size without being asked")
+	}
+	if n, err := Uint64With("10MiB", ConvertOptions{ByteSizes: true}); err != nil || n != 10<<20 {
+		t.Error("Uint64With", n, err)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	d := func(s string) Decimal {
+		parsed, err := ParseDecimal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	if sum := d("0.1").Add(d("0.2")); sum.Cmp(d("0.3")) != 0 || sum.String() != "0.3" {
+		t.Error("0.1 + 0.2 =", sum)
+	}
+	if diff := d("10").Sub(d("0.005")); diff.String() != "9.995" {
+		t.Error("Sub", diff)
+	}
+	if product := d("1.25").Mul(d("-0.3")); product.String() != "-0.375" {
+		t.Error("Mul", product)
+	}
+	third, err := d("1").Div(d("3"), 4, RoundHalfEven)
+	if err != nil || third.String() != "0.3333" {
+		t.Error("Div", third, err)
+	}
+	if _, err := d("1").Div(Decimal{}, 2, RoundDown); err == nil {
+		t.Error("Div by zero")
+	}
+	rounding := map[RoundingMode][]string{ //Results for 2.5, -2.5, 3.5, 2.51
+		RoundHalfEven: {"2", "-2", "4", "3"},
+		RoundHalfUp:   {"3", "-3", "4", "3"},
+		RoundHalfDown: {"2", "-2", "3", "3"},
+		RoundDown:     {"2", "-2", "3", "2"},
+		RoundUp:       {"3", "-3", "4", "3"},
+		RoundFloor:    {"2", "-3", "3", "2"},
+		RoundCeiling:  {"3", "-2", "4", "3"},
+	}
+	for mode, want := range rounding {
+		for i, in := range []string{"2.5", "-2.5", "3.5", "2.51"} {
+			if got := d(in).Round(0, mode).String(); got != want[i] {
+				t.Error("Round", mode, in, got)
+			}
+		}
+	}
+	if s := NewDecimal(5, 3).String(); s != "0.005" || d("1.5e3").String() != "1500" || d("-12e-4").String() != "-0.0012" {
+		t.Error("String", s, d("1.5e3"), d("-12e-4"))
+	}
+	for _, in := range []interface{}{0.1, "0.1", json.Number("0.1"), "0x1", uint64(1 << 63)} {
+		if _, err := DecimalFrom(in); err != nil {
+			t.Error("DecimalFrom", in, err)
+		}
+	}
+	if f, _ := DecimalFrom(0.1); f.String() != "0.1" {
+		t.Error("DecimalFrom float", f)
+	}
+	type Account struct {
+		Balance Decimal
+	}
+	b, err := Marshal(Account{d("1234.50")})
+	if err != nil || strings.TrimSpace(string(b)) != `{"Balance":"1234.50"}` {
+		t.Error("Marshal", string(b), err)
+	}
+	a := Account{}
+	if err := json.Unmarshal([]byte(`{"Balance": 99.95}`), &a); err != nil || a.Balance.String() != "99.95" {
+		t.Error("Unmarshal", a.Balance, err)
+	}
+	if err := json.Unmarshal([]byte(`{"Balance": null}`), &a); err != nil || a.Balance.String() != "99.95" {
+		t.Error("Unmarshal null", a.Balance, err)
+	}
+	for _, bad := range []string{"", "-", "1.2.3", "1e", "abc", "1e99999"} {
+		if _, err := ParseDecimal(bad); err == nil {
+			t.Error("ParseDecimal accepted", bad)
+		}
+	}
+}
+
+func TestBinary(t *testing.T) {
+	type Inner struct {
+		Name  string
+		Score int32 `bin:"fixed"`
+	}
+	type Record struct {
+		Number uint64
+		Delta  int64
+		Flag   bool
+		Ratio  float64
+		Data   []byte
+		Tags   []string
+		Index  map[string]uint16
+		Inner  Inner
+		Next   *Inner
+		Fixed  [2]uint8
+		Cache  string `bin:"-"`
+	}
+	in := Record{300, -2, true, 1.5, []byte{1, 2}, []string{"a", "b"}, map[string]uint16{"z": 1, "a": 2, "m": 3}, Inner{"x", -5}, nil, [2]uint8{7, 8}, "skip"}
+	b, err := EncodeBinary(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ { //Map order must not matter
+		again, _ := EncodeBinary(in)
+		if string(Hash(again)) != string(Hash(b)) {
+			t.Fatal("EncodeBinary not deterministic")
+		}
+	}
+	out := Record{}
+	if err := DecodeBinary(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Cache = ""
+	if String(out) != String(in) {
+		t.Error("DecodeBinary", String(out))
+	}
+	w := &BinaryWriter{}
+	w.Uvarint(300)
+	w.Uint16(0x0102)
+	w.String("hi")
+	if got := w.Result(); string(got) != "\xac\x02\x01\x02\x02hi" {
+		t.Errorf("BinaryWriter %x", got)
+	}
+	for _, bad := range [][]byte{append(b, 0), b[:len(b)-1], append([]byte{0x80, 0x00}, b[1:]...)} {
+		err := DecodeBinary(bad, &Record{})
+		if _, ok := errors.Cause(err).(*DecodeError); !ok || !strings.HasPrefix(err.Error(), "wiz.DecodeBinary: ") {
+			t.Errorf("DecodeBinary accepted %x: %v", bad, err)
+		}
+	}
+	if _, err := EncodeBinary(struct{ C chan int }{}); err == nil {
+		t.Error("EncodeBinary accepted a channel")
+	}
+	if _, err := EncodeBinary(nil); err == nil {
+		t.Error("EncodeBinary accepted nil")
+	}
+	key := [32]byte{}
+	for i := range key {
+		key[i] = 0xff
+	}
+	b, err = EncodeBinary(struct{ Key [32]byte }{key})
+	if err != nil || string(b) != string(key[:]) {
+		t.Errorf("byte array encoded as %x %v", b, err)
+	}
+	id := struct{ ID UUID }{}
+	if err := DecodeBinary(b[:16], &id); err != nil || id.ID[15] != 0xff {
+		t.Error("byte array decode", id, err)
+	}
+}
+
+type stringerWithSecret struct {
+	Password string `wiz:"secret"`
+}
+
+func (s stringerWithSecret) String() string {
+	return "password is " + s.Password
+}
+
+func TestStringWith(t *testing.T) {
+	type Node struct {
+		Name     string
+		Password string `wiz:"secret"`
+		Token    string `json:"token,omitempty"`
+		Key      []byte
+		Next     *Node
+		Labels   map[string]int
+	}
+	n := &Node{Name: "a", Password: "hunter2", Key: []byte{0xde, 0xad}, Labels: map[string]int{"z": 1, "a": 2, "m": 3}}
+	n.Next = n
+	got := StringWith(n, StringOptions{HexBytes: true})
+	want := `{"Name":"a","Password":"[REDACTED]","Key":"dead","Next":"<cycle>","Labels":{"a":2,"m":3,"z":1}}`
+	if got != want {
+		t.Error("StringWith", got)
+	}
+	if !strings.Contains(String(Node{Password: "hunter2"}), "hunter2") {
+		t.Error("String changed its defaults")
+	}
+	if got := StringWith(Node{Name: "b", Token: "t"}, StringOptions{RedactFields: []string{"TOKEN"}}); !strings.Contains(got, `"token":"[REDACTED]"`) {
+		t.Error("RedactFields", got)
+	}
+	if got := StringWith([][]int{{1, 2}, {3}}, StringOptions{MaxDepth: 1}); got != `["...","..."]` {
+		t.Error("MaxDepth", got)
+	}
+	if got := StringWith(strings.Repeat("é", 10), StringOptions{MaxLength: 8}); got != "éé..." {
+		t.Error("MaxLength", got)
+	}
+	for max, want := range map[int]string{1: "a", 2: "ab", 3: "...", 4: "a..."} {
+		if got := StringWith("abcdef", StringOptions{MaxLength: max}); got != want {
+			t.Error("MaxLength", max, got)
+		}
+	}
+	if got := StringWith("éé", StringOptions{MaxLength: 1}); got != "" {
+		t.Error("MaxLength split a rune", got)
+	}
+	if got := StringWith([]byte{0xde, 0xad}, StringOptions{}); got != String([]byte{0xde, 0xad}) {
+		t.Error("bytes", got)
+	}
+	if got := StringWith(map[int]Decimal{2: NewDecimal(5, 1), 1: {}}, StringOptions{}); got != `{"1":"0","2":"0.5"}` {
+		t.Error("map", got)
+	}
+	//With no options, StringWith matches String (without String's newline) for ordinary values
+	type Embedded struct{ Inner int }
+	type Shape struct {
+		Embedded
+		Name   string            `json:"name"`
+		Skip   string            `json:"-"`
+		Empty  string            `json:",omitempty"`
+		Floats []float64         `json:"floats"`
+		Nested map[string][]bool `json:"nested"`
+		When   time.Time
+		Ptr    *int
+		hidden int
+	}
+	shapes := []interface{}{
+		nil, "text", 42, 1.5, []byte{1, 2, 3}, [2]byte{4, 5}, []int{1, 2}, map[string]int{"b": 2, "a": 1},
+		Shape{Embedded{7}, "<n&m>", "s", "", []float64{1e21, 1e-7, 0.5, -0}, map[string][]bool{"x": {true}}, time.Unix(0, 0).UTC(), nil, 1},
+		&Shape{Name: "ptr"}, make(chan int), NewDecimal(1234, 2), time.Second,
+	}
+	for _, shape := range shapes {
+		if got, want := StringWith(shape, StringOptions{}), strings.TrimSuffix(String(shape), "\n"); got != want {
+			t.Errorf("StringWith(%T) = %s, String gives %s", shape, got, want)
+		}
+	}
+	//A Stringer with secret fields is rendered and redacted rather than trusted
+	if got := StringWith(stringerWithSecret{"hunter2"}, StringOptions{}); strings.Contains(got, "hunter2") {
+		t.Error("Stringer leaked a secret", got)
+	}
+}
+
+func TestSecret(t *testing.T) {
+	type Login struct {
+		User     string
+		Password Secret
+		Key      SecretBytes
+	}
+	raw := []byte("s3cr3t-key")
+	l := Login{"bob", NewSecret("hunter2"), NewSecretBytes(raw)}
+	out := fmt.Sprintf("%v %+v %#v %s %q %x %d", l, l, l, l.Password, l.Key, l.Key, l.Password)
+	out += String(l) + StringWith(l, StringOptions{}) + String(l.Password)
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "s3cr3t") || strings.Contains(out, "73336372") {
+		t.Error("Secret leaked", out)
+	}
+	if !strings.Contains(String(l), `"Password":"[REDACTED]"`) {
+		t.Error("MarshalJSON", String(l))
+	}
+	if l.Password.Reveal() != "hunter2" || string(l.Key.Reveal()) != "s3cr3t-key" {
+		t.Error("Reveal")
+	}
+	if !l.Password.Equal(NewSecret("hunter2")) || l.Password.Equal(NewSecret("hunter3")) || l.Password.Equal(Secret{}) {
+		t.Error("Equal")
+	}
+	copied := l.Key
+	l.Key.Wipe()
+	if l.Key.Len() != 0 || string(raw) != strings.Repeat("\x00", len(raw)) {
+		t.Error("Wipe", raw)
+	}
+	//Copies share the secret, so they are wiped too
+	if copied.Len() != 0 || len(copied.Reveal()) != 0 || copied.Equal(NewSecretBytes(make([]byte, len(raw)))) {
+		t.Error("copy survived Wipe", copied.Reveal())
+	}
+	p := l.Password
+	l.Password.Wipe()
+	if p.Len() != 0 || p.Reveal() != "" || p.Equal(NewSecret("\x00\x00\x00\x00\x00\x00\x00")) {
+		t.Error("Secret copy survived Wipe", p.Len())
+	}
+	var empty Secret
+	empty.Wipe()
+	//Empty secrets, wiped or not, never match, so a wiped token can't be matched by empty input
+	if empty.Equal(NewSecret("")) || p.Equal(NewSecret("")) || NewSecret("").Equal(NewSecret("")) || (SecretBytes{}).Equal(NewSecretBytes([]byte{})) {
+		t.Error("empty secrets matched")
+	}
+}
+
+func TestCase(t *testing.T) {
+	cases := []struct{ in, snake, camel, pascal, kebab, screaming string }{
+		{"userID", "user_id", "userId", "UserId", "user-id", "USER_ID"},
+		{"HTTPServer", "http_server", "httpServer", "HttpServer", "http-server", "HTTP_SERVER"},
+		{"base64Encode", "base64_encode", "base64Encode", "Base64Encode", "base64-encode", "BASE64_ENCODE"},
+		{"  max-retry_COUNT2 ", "max_retry_count2", "maxRetryCount2", "MaxRetryCount2", "max-retry-count2", "MAX_RETRY_COUNT2"},
+		{"ÉtéÀParis", "été_à_paris", "étéÀParis", "ÉtéÀParis", "été-à-paris", "ÉTÉ_À_PARIS"},
+		{"", "", "", "", "", ""},
+	}
+	for _, c := range cases {
+		got := []string{SnakeCase(c.in), CamelCase(c.in), PascalCase(c.in), KebabCase(c.in), ScreamingCase(c.in)}
+		want := []string{c.snake, c.camel, c.pascal, c.kebab, c.screaming}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Error(c.in, got)
+		}
+	}
+	slugs := map[string]string{
+		"Crème Brûlée: 2 ways!":     "creme-brulee-2-ways",
+		"Straße Łódź Ærø":           "strasse-lodz-aero",
+		"Cafe\u0301 -- Don't Panic": "cafe-dont-panic",
+		"日本語 Go":                    "go",
+		"---":                       "",
+		"Việt Nam":                  "viet-nam",
+		"Thành phố Hồ Chí Minh":     "thanh-pho-ho-chi-minh",
+		"Ḍhaka Ẁales Ỳork":          "dhaka-wales-york",
+		"Đà Nẵng ẞ Øresund":         "da-nang-ss-oresund",
+	}
+	for in, want := range slugs {
+		if got := Slugify(in); got != want {
+			t.Error("Slugify", in, got)
+		}
+	}
+	if StipNonASCII("a€b") != "ab" || StripNonASCII("a€b") != "ab" {
+		t.Error("StripNonASCII")
+	}
+}